@@ -0,0 +1,167 @@
+package gnet
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 发包限速设置
+type SendBandwidthConfig struct {
+	// 每个连接的发包限速(字节/秒),为0时不限速
+	BytesPerSecond uint32
+	// 每个连接允许的突发字节数,为0时使用BytesPerSecond
+	BurstBytes uint32
+	// TcpListener的所有accept连接共享的发包总限速(字节/秒),只对TcpListener有效,为0时不限速
+	ListenerBytesPerSecond uint32
+	// TcpListener允许的突发字节数,为0时使用ListenerBytesPerSecond
+	ListenerBurstBytes uint32
+	// 不受限速的消息号,如踢人通知等控制消息
+	// 心跳包和SendPriorityHigh的数据包总是不受限速
+	// 不受限速的数据包直接写入socket,不等待令牌,也不消耗令牌
+	// TcpConnection的发送缓存里,不受限速的数据包前面最多还有maxWriteSize字节受限速的数据
+	BypassCommands []PacketCommand
+}
+
+func newBandwidthBucket(bytesPerSecond, burstBytes uint32) *tokenBucket {
+	return newTokenBucket(&RateLimit{Rate: float64(bytesPerSecond), Burst: float64(burstBytes)})
+}
+
+// 连接的发包限速
+// 只在发包协程中使用
+type sendBandwidthLimiter struct {
+	connectionBucket *tokenBucket
+	// TcpListener共享的令牌桶
+	listenerBucket *tokenBucket
+	bypassCommands map[PacketCommand]struct{}
+	// 已经编码还未发送的数据,按顺序记录是否受限速(只用于TcpConnection)
+	segments []sendSegment
+	// segments里受限速的字节数
+	limitedBytes int
+}
+
+// 一段连续的已经编码还未发送的数据
+type sendSegment struct {
+	size   int
+	bypass bool
+}
+
+func newSendBandwidthLimiter(config *SendBandwidthConfig) *sendBandwidthLimiter {
+	if config == nil {
+		return nil
+	}
+	limiter := &sendBandwidthLimiter{
+		connectionBucket: newBandwidthBucket(config.BytesPerSecond, config.BurstBytes),
+		bypassCommands:   make(map[PacketCommand]struct{}),
+	}
+	for _, command := range config.BypassCommands {
+		limiter.bypassCommands[command] = struct{}{}
+	}
+	return limiter
+}
+
+// 该数据包是否不受限速
+func (this *sendBandwidthLimiter) isBypass(packet Packet, priority SendPriority) bool {
+	if priority == SendPriorityHigh {
+		return true
+	}
+	_, ok := this.bypassCommands[packet.Command()]
+	return ok
+}
+
+// 记录编码后的n字节数据
+func (this *sendBandwidthLimiter) addEncoded(n int, bypass bool) {
+	if n <= 0 {
+		return
+	}
+	if !bypass {
+		this.limitedBytes += n
+	}
+	if count := len(this.segments); count > 0 && this.segments[count-1].bypass == bypass {
+		this.segments[count-1].size += n
+		return
+	}
+	this.segments = append(this.segments, sendSegment{size: n, bypass: bypass})
+}
+
+// 受限速的数据是否已经攒够一次写入的数据量,攒够之后不再编码新的数据包
+// 这样不受限速的数据包最多排在maxWriteSize字节的受限速数据后面
+func (this *sendBandwidthLimiter) isBatchFull() bool {
+	maxSize := this.maxWriteSize()
+	return maxSize > 0 && this.limitedBytes >= maxSize
+}
+
+// 估算数据包编码后的大小(不包含包头),用于TcpConnectionNoRing限制一批发送的受限速数据量
+func estimatePacketSize(packet Packet) int {
+	if data := packet.GetStreamData(); len(data) > 0 {
+		return len(data)
+	}
+	if message := packet.Message(); message != nil {
+		return proto.Size(message)
+	}
+	return 0
+}
+
+// 下一次写入的字节数,以及这些数据是否不受限速
+// n:可以写入的最大字节数
+func (this *sendBandwidthLimiter) nextWrite(n int) (size int, bypass bool) {
+	size = n
+	if len(this.segments) > 0 {
+		bypass = this.segments[0].bypass
+		if this.segments[0].size < size {
+			size = this.segments[0].size
+		}
+	}
+	if !bypass {
+		if maxSize := this.maxWriteSize(); maxSize > 0 && size > maxSize {
+			size = maxSize
+		}
+	}
+	return
+}
+
+// 写入了n字节数据
+func (this *sendBandwidthLimiter) onWritten(n int) {
+	for n > 0 && len(this.segments) > 0 {
+		segment := &this.segments[0]
+		written := n
+		if segment.size < written {
+			written = segment.size
+		}
+		segment.size -= written
+		if !segment.bypass {
+			this.limitedBytes -= written
+		}
+		n -= written
+		if segment.size == 0 {
+			this.segments = this.segments[1:]
+		}
+	}
+}
+
+// 单次发送的最大字节数,防止一次预支过多的令牌,0表示不限制
+func (this *sendBandwidthLimiter) maxWriteSize() int {
+	maxSize := 0
+	for _, bucket := range [2]*tokenBucket{this.connectionBucket, this.listenerBucket} {
+		if bucket != nil && (maxSize == 0 || int(bucket.burst) < maxSize) {
+			maxSize = int(bucket.burst)
+		}
+	}
+	return maxSize
+}
+
+// 发送n字节受限速的数据之前调用,令牌不足时阻塞等待
+// n不应该超过maxWriteSize,防止共享的令牌桶预支过多的令牌
+// 等待期间连接关闭时返回false
+func (this *sendBandwidthLimiter) wait(n int, closeNotify <-chan struct{}) bool {
+	now := time.Now()
+	var wait time.Duration
+	for _, bucket := range [2]*tokenBucket{this.connectionBucket, this.listenerBucket} {
+		if bucket != nil {
+			if bucketWait := bucket.reserve(now, float64(n)); bucketWait > wait {
+				wait = bucketWait
+			}
+		}
+	}
+	return sleepOrClose(wait, closeNotify)
+}
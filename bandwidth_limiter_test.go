@@ -0,0 +1,72 @@
+package gnet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendBandwidthLimiter(t *testing.T) {
+	config := &ConnectionConfig{
+		SendPacketCacheCap: 1,
+		SendBandwidth: &SendBandwidthConfig{
+			BytesPerSecond: 1000,
+			BurstBytes:     100,
+			BypassCommands: []PacketCommand{1},
+		},
+	}
+	connection := newTestConnection(config, NewProtoCodec(nil), nil)
+	limiter := connection.sendLimiter
+	if limiter.maxWriteSize() != 100 || !limiter.isBypass(NewProtoPacket(1, nil), SendPriorityNormal) ||
+		limiter.isBypass(NewProtoPacket(2, nil), SendPriorityNormal) || !limiter.isBypass(NewProtoPacket(2, nil), SendPriorityHigh) {
+		t.Fatalf("maxWriteSize:%v", limiter.maxWriteSize())
+	}
+	begin := time.Now()
+	limiter.wait(100, connection.closeNotify)
+	if cost := time.Since(begin); cost > time.Millisecond*20 {
+		t.Fatalf("burst cost:%v", cost)
+	}
+	limiter.wait(50, connection.closeNotify)
+	if cost := time.Since(begin); cost < time.Millisecond*40 {
+		t.Fatalf("limit cost:%v", cost)
+	}
+
+	// 按顺序记录受限速和不受限速的数据,受限速的数据每次最多写入maxWriteSize字节
+	limiter.addEncoded(150, false)
+	limiter.addEncoded(20, true)
+	limiter.addEncoded(30, true)
+	if !limiter.isBatchFull() || len(limiter.segments) != 2 {
+		t.Fatalf("segments:%v", limiter.segments)
+	}
+	expectWrites := []sendSegment{{100, false}, {50, false}, {50, true}}
+	for _, expectWrite := range expectWrites {
+		size, bypass := limiter.nextWrite(1000)
+		if size != expectWrite.size || bypass != expectWrite.bypass {
+			t.Fatalf("size:%v bypass:%v expect:%v", size, bypass, expectWrite)
+		}
+		limiter.onWritten(size)
+	}
+	if len(limiter.segments) != 0 || limiter.limitedBytes != 0 || limiter.isBatchFull() {
+		t.Fatalf("segments:%v limitedBytes:%v", limiter.segments, limiter.limitedBytes)
+	}
+
+	// 等待令牌时连接关闭
+	time.AfterFunc(time.Millisecond*10, func() {
+		connection.Close()
+	})
+	if limiter.wait(1000, connection.closeNotify) {
+		t.Fatal("wait after close")
+	}
+
+	// TcpListener的总限速由多个连接共享
+	listenerBucket := newBandwidthBucket(1000, 100)
+	connection1 := NewTcpConnector(&ConnectionConfig{SendPacketCacheCap: 1}, NewProtoCodec(nil), nil)
+	connection2 := NewTcpConnector(&ConnectionConfig{SendPacketCacheCap: 1}, NewProtoCodec(nil), nil)
+	connection1.setListenerSendBucket(listenerBucket)
+	connection2.setListenerSendBucket(listenerBucket)
+	begin = time.Now()
+	connection1.sendLimiter.wait(100, connection1.closeNotify)
+	connection2.sendLimiter.wait(50, connection2.closeNotify)
+	if cost := time.Since(begin); cost < time.Millisecond*40 {
+		t.Fatalf("listener limit cost:%v", cost)
+	}
+}
@@ -0,0 +1,51 @@
+package gnet
+
+import (
+	"testing"
+)
+
+// TcpConnection收发超出RingBuffer大小和超出MaxPacketDataSize的数据包
+func TestRingBufferBigPacket(t *testing.T) {
+	codec := NewDefaultCodec()
+	config := &ConnectionConfig{SendBufferSize: 1024 * 64, RecvBufferSize: 1024 * 64, MaxPacketSize: MaxPacketDataSize * 3}
+	sender, receiver := newCodecTestConnections(codec, config)
+	for _, packetDataSize := range []int{1024 * 100, MaxPacketDataSize*2 + 100, 100} {
+		packetData := make([]byte, packetDataSize)
+		for i := range packetData {
+			packetData[i] = byte(i)
+		}
+		delayData := sender.encodePacket(NewDataPacket(packetData), SendPriorityNormal)
+		if packetDataSize > MaxPacketDataSize && len(delayData) < 2 {
+			// 分片数据不合并成一块内存
+			t.Fatalf("delayData:%v", len(delayData))
+		}
+		var packet Packet
+		for packet == nil {
+			transferCodecTestData(sender, receiver)
+			delayData = writeDelaySendData(sender.sendBuffer, delayData)
+			var err error
+			packet, err = codec.Decode(receiver, nil)
+			if err != nil {
+				t.Fatalf("decode err:%v", err)
+			}
+		}
+		if string(packet.GetStreamData()) != string(packetData) {
+			t.Fatalf("packet data error size:%v", packetDataSize)
+		}
+	}
+
+	// 分片重组后超出MaxPacketSize
+	config.MaxPacketSize = MaxPacketDataSize + 100
+	delayData := sender.encodePacket(NewDataPacket(make([]byte, MaxPacketDataSize+101)), SendPriorityNormal)
+	for {
+		transferCodecTestData(sender, receiver)
+		delayData = writeDelaySendData(sender.sendBuffer, delayData)
+		_, err := codec.Decode(receiver, nil)
+		if err == ErrPacketLengthExceed {
+			break
+		}
+		if err != nil || receiver.recvBuffer.UnReadLength() > 0 {
+			t.Fatalf("err:%v", err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package gnet
+
+import (
+	"fmt"
+)
+
+// 连接关闭原因的分类
+type CloseCode uint8
+
+const (
+	// 本地调用Close
+	CloseCodeLocal CloseCode = iota + 1
+	// 本地调用CloseGracefully
+	CloseCodeGraceful
+	// 对方关闭了连接(读取到EOF)
+	CloseCodePeerEOF
+	// 读socket出错
+	CloseCodeReadError
+	// 写socket出错(包括写超时)
+	CloseCodeWriteError
+	// 收包超时
+	CloseCodeRecvTimeout
+	// 解码出错
+	CloseCodeDecodeError
+	// NetMgr或Listener关闭
+	CloseCodeShutdown
+	// 发包缓存满(SendOverflowDisconnect)
+	CloseCodeSendOverflow
+	// 超出收包限速(RateLimitClose)
+	CloseCodeRateLimit
+	// 收包队列满
+	CloseCodeRecvOverflow
+	// connector连接失败
+	CloseCodeConnectFailed
+)
+
+var closeCodeNames = map[CloseCode]string{
+	CloseCodeLocal:         "Local",
+	CloseCodeGraceful:      "Graceful",
+	CloseCodePeerEOF:       "PeerEOF",
+	CloseCodeReadError:     "ReadError",
+	CloseCodeWriteError:    "WriteError",
+	CloseCodeRecvTimeout:   "RecvTimeout",
+	CloseCodeDecodeError:   "DecodeError",
+	CloseCodeShutdown:      "Shutdown",
+	CloseCodeSendOverflow:  "SendOverflow",
+	CloseCodeRateLimit:     "RateLimit",
+	CloseCodeRecvOverflow:  "RecvOverflow",
+	CloseCodeConnectFailed: "ConnectFailed",
+}
+
+func (this CloseCode) String() string {
+	if name, ok := closeCodeNames[this]; ok {
+		return name
+	}
+	return fmt.Sprintf("CloseCode(%d)", uint8(this))
+}
+
+// 连接关闭原因
+type CloseReason struct {
+	// 分类
+	Code CloseCode
+	// 具体的错误,可能为nil
+	Err error
+}
+
+func (this *CloseReason) Error() string {
+	if this.Err == nil {
+		return this.Code.String()
+	}
+	return this.Code.String() + ": " + this.Err.Error()
+}
+
+func (this *CloseReason) Unwrap() error {
+	return this.Err
+}
+
+// 记录关闭原因,只记录第一次
+func (this *baseConnection) setCloseReason(code CloseCode, err error) {
+	this.closeReasonLock.Lock()
+	defer this.closeReasonLock.Unlock()
+	if this.closeReason == nil {
+		this.closeReason = &CloseReason{Code: code, Err: err}
+	}
+}
+
+// 连接关闭原因,连接还没关闭时返回nil
+func (this *baseConnection) GetCloseReason() *CloseReason {
+	this.closeReasonLock.Lock()
+	defer this.closeReasonLock.Unlock()
+	return this.closeReason
+}
+
+// 支持记录关闭原因的连接
+type closeReasonSetter interface {
+	setCloseReason(code CloseCode, err error)
+}
+
+// 记录关闭原因并关闭连接
+func closeWithReason(connection Connection, code CloseCode, err error) {
+	if setter, ok := connection.(closeReasonSetter); ok {
+		setter.setCloseReason(code, err)
+	}
+	connection.Close()
+}
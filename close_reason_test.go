@@ -0,0 +1,36 @@
+package gnet
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestCloseReason(t *testing.T) {
+	var disconnectReason *CloseReason
+	handler := NewDefaultConnectionHandler(nil)
+	handler.SetOnDisconnectedFunc(func(connection Connection, reason *CloseReason) {
+		disconnectReason = reason
+	})
+	connection := NewTcpConnector(&ConnectionConfig{SendPacketCacheCap: 1}, NewDefaultCodec(), handler)
+	if connection.GetCloseReason() != nil {
+		t.Fatal("close reason before close")
+	}
+	// 只记录第一次的关闭原因
+	connection.setCloseReason(CloseCodePeerEOF, io.EOF)
+	connection.setCloseReason(CloseCodeWriteError, nil)
+	connection.Close()
+	reason := connection.GetCloseReason()
+	if reason != disconnectReason || reason.Code != CloseCodePeerEOF || !errors.Is(reason, io.EOF) {
+		t.Fatalf("reason:%v", reason)
+	}
+	if reason.Error() != "PeerEOF: EOF" {
+		t.Fatalf("reason:%v", reason.Error())
+	}
+
+	connection = NewTcpConnector(&ConnectionConfig{SendPacketCacheCap: 1}, NewDefaultCodec(), nil)
+	connection.Close()
+	if connection.GetCloseReason().Code != CloseCodeLocal {
+		t.Fatalf("reason:%v", connection.GetCloseReason())
+	}
+}
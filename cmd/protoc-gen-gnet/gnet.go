@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+const (
+	gnetPackage  = protogen.GoImportPath("github.com/fish-tennis/gnet")
+	protoPackage = protogen.GoImportPath("google.golang.org/protobuf/proto")
+
+	// 消息号枚举类型名的前缀,如CmdTest
+	commandEnumPrefix = "Cmd"
+	// 消息号枚举值名的前缀,如Cmd_TestMessage
+	commandValuePrefix = "Cmd_"
+)
+
+// 消息回调的方向
+type handlerSide struct {
+	// 接口名的后缀
+	name string
+	// 注释
+	comment string
+	// 依次尝试的消息名后缀
+	messageSuffixes []string
+}
+
+var handlerSides = []handlerSide{
+	{name: "Server", comment: "服务器端的消息回调,收到的是Xxx或XxxReq消息", messageSuffixes: []string{"", "Req"}},
+	{name: "Client", comment: "客户端的消息回调,收到的是Xxx或XxxRes消息", messageSuffixes: []string{"", "Res"}},
+}
+
+// 所有方向的消息名后缀,用于检查找不到对应消息的枚举值
+var allMessageSuffixes = []string{"", "Req", "Res"}
+
+// 消息号和消息的对应关系
+type commandMessage struct {
+	command *protogen.EnumValue
+	message *protogen.Message
+}
+
+func generateFile(gen *protogen.Plugin, file *protogen.File) *protogen.GeneratedFile {
+	var commandEnums []*protogen.Enum
+	for _, enum := range file.Enums {
+		if strings.HasPrefix(string(enum.Desc.Name()), commandEnumPrefix) {
+			commandEnums = append(commandEnums, enum)
+		}
+	}
+	if len(commandEnums) == 0 {
+		return nil
+	}
+	filename := file.GeneratedFilenamePrefix + "_gnet.pb.go"
+	g := gen.NewGeneratedFile(filename, file.GoImportPath)
+	g.P("// Code generated by protoc-gen-gnet. DO NOT EDIT.")
+	g.P("// source: ", file.Desc.Path())
+	g.P()
+	g.P("package ", file.GoPackageName)
+	g.P()
+
+	sendMessages := make(map[*protogen.Message]*protogen.EnumValue)
+	var sendMessageOrder []*protogen.Message
+	for _, enum := range commandEnums {
+		findCommandMessages(file, enum, allMessageSuffixes, true)
+		for _, side := range handlerSides {
+			commandMessages := findCommandMessages(file, enum, side.messageSuffixes, false)
+			generateHandler(g, enum, side, commandMessages)
+			for _, commandMessage := range commandMessages {
+				if _, ok := sendMessages[commandMessage.message]; !ok {
+					sendMessages[commandMessage.message] = commandMessage.command
+					sendMessageOrder = append(sendMessageOrder, commandMessage.message)
+				}
+			}
+		}
+	}
+
+	for _, message := range sendMessageOrder {
+		command := sendMessages[message]
+		g.P("// 发送", message.GoIdent.GoName, "消息,消息号", command.GoIdent.GoName)
+		g.P("func Send", message.GoIdent.GoName, "(connection ", g.QualifiedGoIdent(gnetPackage.Ident("Connection")),
+			", message *", message.GoIdent, ") bool {")
+		g.P("return connection.Send(", g.QualifiedGoIdent(gnetPackage.Ident("PacketCommand")), "(", command.GoIdent, "), message)")
+		g.P("}")
+		g.P()
+	}
+	return g
+}
+
+// 找出消息号枚举值对应的消息
+// warn:不符合命名规范和找不到对应消息的枚举值,输出警告
+func findCommandMessages(file *protogen.File, enum *protogen.Enum, messageSuffixes []string, warn bool) []*commandMessage {
+	messages := make(map[string]*protogen.Message)
+	for _, message := range file.Messages {
+		messages[string(message.Desc.Name())] = message
+	}
+	var commandMessages []*commandMessage
+	for _, value := range enum.Values {
+		if value.Desc.Number() == 0 {
+			continue
+		}
+		valueName := string(value.Desc.Name())
+		if !strings.HasPrefix(valueName, commandValuePrefix) {
+			if warn {
+				fmt.Fprintf(os.Stderr, "protoc-gen-gnet: %v not start with %v\n", value.Desc.FullName(), commandValuePrefix)
+			}
+			continue
+		}
+		messageName := strings.TrimPrefix(valueName, commandValuePrefix)
+		found := false
+		for _, suffix := range messageSuffixes {
+			if message, ok := messages[messageName+suffix]; ok {
+				commandMessages = append(commandMessages, &commandMessage{command: value, message: message})
+				found = true
+				break
+			}
+		}
+		if !found && warn {
+			fmt.Fprintf(os.Stderr, "protoc-gen-gnet: %v no message found, suffixes:%q\n", value.Desc.FullName(), messageSuffixes)
+		}
+	}
+	return commandMessages
+}
+
+// 生成消息回调接口,消息注册函数和消息回调注册函数
+func generateHandler(g *protogen.GeneratedFile, enum *protogen.Enum, side handlerSide, commandMessages []*commandMessage) {
+	if len(commandMessages) == 0 {
+		return
+	}
+	connectionIdent := g.QualifiedGoIdent(gnetPackage.Ident("Connection"))
+	packetCommandIdent := g.QualifiedGoIdent(gnetPackage.Ident("PacketCommand"))
+	protoMessageIdent := g.QualifiedGoIdent(protoPackage.Ident("Message"))
+	interfaceName := enum.GoIdent.GoName + side.name + "Handler"
+
+	g.P("// ", enum.GoIdent.GoName, side.comment)
+	g.P("type ", interfaceName, " interface {")
+	for _, commandMessage := range commandMessages {
+		g.P("On", commandMessage.message.GoIdent.GoName, "(connection ", connectionIdent, ", message *", commandMessage.message.GoIdent, ")")
+	}
+	g.P("}")
+	g.P()
+
+	g.P("// 注册", enum.GoIdent.GoName, "的消息号和消息构造函数(", side.name, ")")
+	g.P("func Register", enum.GoIdent.GoName, side.name, "Messages(protoRegister ", g.QualifiedGoIdent(gnetPackage.Ident("ProtoRegister")), ") {")
+	for _, commandMessage := range commandMessages {
+		g.P("protoRegister.Register(", packetCommandIdent, "(", commandMessage.command.GoIdent, "), func() ", protoMessageIdent, " {")
+		g.P("return new(", commandMessage.message.GoIdent, ")")
+		g.P("})")
+	}
+	g.P("}")
+	g.P()
+
+	g.P("// 注册", interfaceName, "的所有消息回调和消息构造函数")
+	g.P("func Register", interfaceName, "(register ", g.QualifiedGoIdent(gnetPackage.Ident("PacketHandlerRegister")), ", handler ", interfaceName, ") {")
+	for _, commandMessage := range commandMessages {
+		g.P("register.Register(", packetCommandIdent, "(", commandMessage.command.GoIdent, "), func(connection ", connectionIdent,
+			", packet *", g.QualifiedGoIdent(gnetPackage.Ident("ProtoPacket")), ") {")
+		g.P("handler.On", commandMessage.message.GoIdent.GoName, "(connection, packet.Message().(*", commandMessage.message.GoIdent, "))")
+		g.P("}, func() ", protoMessageIdent, " {")
+		g.P("return new(", commandMessage.message.GoIdent, ")")
+		g.P("})")
+	}
+	g.P("}")
+	g.P()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/fish-tennis/gnet/example/pb"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+var update = flag.Bool("update", false, "update example/pb/test_gnet.pb.go")
+
+// 用example/pb/test.proto生成代码,并与example/pb/test_gnet.pb.go比较
+// go test ./cmd/protoc-gen-gnet -update 更新生成的代码
+func TestGenerateTestProto(t *testing.T) {
+	request := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{pb.File_test_proto.Path()},
+		Parameter:      proto.String("M" + pb.File_test_proto.Path() + "=github.com/fish-tennis/gnet/example/pb"),
+		ProtoFile:      []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(pb.File_test_proto)},
+	}
+	gen, err := protogen.Options{}.New(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range gen.Files {
+		if f.Generate {
+			generateFile(gen, f)
+		}
+	}
+	response := gen.Response()
+	if response.Error != nil || len(response.File) != 1 {
+		t.Fatalf("response:%v", response)
+	}
+	content := response.File[0].GetContent()
+	goldenFile := "../../example/pb/test_gnet.pb.go"
+	if *update {
+		if err := os.WriteFile(goldenFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(golden) != content {
+		t.Fatalf("%v is not up to date, run: go test ./cmd/protoc-gen-gnet -update", goldenFile)
+	}
+}
@@ -0,0 +1,26 @@
+// protoc插件,根据消息号枚举(Cmd_MessageName)生成gnet的辅助代码
+//
+// 生成的代码包括:
+//  消息号和消息构造函数的注册
+//  发消息的辅助函数,如SendTestMessage(connection, message)
+//  每个消息号枚举对应一个服务器端和一个客户端的消息回调接口,以及注册函数
+//
+// 用法:
+//  go install github.com/fish-tennis/gnet/cmd/protoc-gen-gnet
+//  protoc --go_out=. --gnet_out=. test.proto
+package main
+
+import (
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+func main() {
+	protogen.Options{}.Run(func(gen *protogen.Plugin) error {
+		for _, f := range gen.Files {
+			if f.Generate {
+				generateFile(gen, f)
+			}
+		}
+		return nil
+	})
+}
@@ -1,7 +1,5 @@
 package gnet
 
-import "io"
-
 // 连接的编解码接口
 type Codec interface {
 	// 包头长度
@@ -36,13 +34,68 @@ type RingBufferCodec struct {
 	HeaderDecoder func(connection Connection, headerData []byte)
 	// 包体的解码接口
 	DataDecoder func(connection Connection, packetHeader PacketHeader, packetData []byte) Packet
+	// 数据包序列号设置(防重放,防篡改),为nil表示不开启
+	// 序列号在DataEncoder之后添加,在DataDecoder之前校验
+	Sequence *PacketSequenceConfig
+	// 自定义包头格式,为nil时使用DefaultPacketHeader
+	// 包头里有消息号时,ProtoCodec不再把消息号编码到包体里
+	HeaderLayout *PacketHeaderLayout
+	// 连接级别的消息号转换,为nil时不转换
+	CommandMapper CommandMapper
+}
+
+// 连接级别的消息号转换,如MessageRegistry的协商模式,每个连接可以使用不同的消息号
+// 在收包协程和发包协程中调用,需要支持并发
+type CommandMapper interface {
+	// 本地的消息号转换成发给对方的消息号
+	ToRemoteCommand(connection Connection, command PacketCommand) PacketCommand
+	// 对方发来的消息号转换成本地的消息号
+	ToLocalCommand(connection Connection, command PacketCommand) PacketCommand
+}
+
+// 设置连接级别的消息号转换
+func (this *RingBufferCodec) SetCommandMapper(commandMapper CommandMapper) {
+	this.CommandMapper = commandMapper
+}
+
+// 本地的消息号转换成发给对方的消息号
+func (this *RingBufferCodec) toRemoteCommand(connection Connection, command PacketCommand) PacketCommand {
+	if this.CommandMapper == nil || connection == nil {
+		return command
+	}
+	return this.CommandMapper.ToRemoteCommand(connection, command)
+}
+
+// 对方发来的消息号转换成本地的消息号
+func (this *RingBufferCodec) toLocalCommand(connection Connection, command PacketCommand) PacketCommand {
+	if this.CommandMapper == nil || connection == nil {
+		return command
+	}
+	return this.CommandMapper.ToLocalCommand(connection, command)
 }
 
+// 数据包序列号设置
+func (this *RingBufferCodec) sequenceConfig() *PacketSequenceConfig {
+	return this.Sequence
+}
+
+// 支持数据包序列号的编解码
+type sequenceCodec interface {
+	sequenceConfig() *PacketSequenceConfig
+}
+
+// 使用了HeaderLayout时,返回包头的最大长度
 func (this *RingBufferCodec) PacketHeaderSize() uint32 {
+	if this.HeaderLayout != nil {
+		return uint32(this.HeaderLayout.MaxSize())
+	}
 	return uint32(DefaultPacketHeaderSize)
 }
 
 func (this *RingBufferCodec) CreatePacketHeader(connection Connection, packet Packet, packetData []byte) PacketHeader {
+	if this.HeaderLayout != nil {
+		return NewLayoutPacketHeader(this.HeaderLayout)
+	}
 	return NewDefaultPacketHeader(0,0)
 }
 
@@ -51,7 +104,6 @@ func (this *RingBufferCodec) CreatePacketHeader(connection Connection, packet Pa
 func (this *RingBufferCodec) Encode(connection Connection, packet Packet) []byte {
 	// 优化思路:编码后的数据直接写入RingBuffer.sendBuffer,可以减少一些内存分配
 	if tcpConnection,ok := connection.(*TcpConnection); ok {
-		packetHeaderSize := int(this.PacketHeaderSize())
 		sendBuffer := tcpConnection.sendBuffer
 		var encodedData [][]byte
 		if this.DataEncoder != nil {
@@ -66,9 +118,42 @@ func (this *RingBufferCodec) Encode(connection Connection, packet Packet) []byte
 		for _,data := range encodedData {
 			encodedDataLen += len(data)
 		}
-		packetHeader := NewDefaultPacketHeader(uint32(encodedDataLen), 0)
+		if this.Sequence != nil {
+			encodedDataLen += this.Sequence.overhead()
+		}
+		// 在分配序列号之前检查长度,否则对方会因为跳号而拒绝后面的数据包
+		if this.HeaderLayout != nil && !this.HeaderLayout.canEncodeLen(uint64(encodedDataLen)) {
+			logger.Error("%v packet length exceed header layout cmd:%v len:%v", tcpConnection.GetConnectionId(), packet.Command(), encodedDataLen)
+			return nil
+		}
+		var layoutPacketHeader *LayoutPacketHeader
+		if this.HeaderLayout != nil {
+			layoutPacketHeader = NewLayoutPacketHeader(this.HeaderLayout)
+			layoutPacketHeader.fill(connection, &tcpConnection.sequence, packet, this.toRemoteCommand(connection, packet.Command()))
+		}
+		if this.Sequence != nil {
+			var headerData []byte
+			if layoutPacketHeader != nil {
+				// 包头里的消息号等字段也要防篡改
+				headerData = layoutPacketHeader.fieldsExceptLen()
+			}
+			encodedData = this.Sequence.encode(connection, &tcpConnection.sequence, headerData, encodedData)
+		}
+		if this.HeaderLayout == nil && encodedDataLen > MaxPacketDataSize {
+			// 超出DefaultPacketHeader的长度限制,分片发送
+			return this.encodeFragments(tcpConnection, packet, encodedData, encodedDataLen)
+		}
+		var packetHeader PacketHeader
+		packetHeaderSize := DefaultPacketHeaderSize
+		if layoutPacketHeader != nil {
+			layoutPacketHeader.SetLen(uint32(encodedDataLen))
+			packetHeader = layoutPacketHeader
+			packetHeaderSize = layoutPacketHeader.Size()
+		} else {
+			packetHeader = NewDefaultPacketHeader(uint32(encodedDataLen), 0)
+		}
 		writeBuffer := sendBuffer.WriteBuffer()
-		if packetHeaderSize == DefaultPacketHeaderSize && len(writeBuffer) >= packetHeaderSize {
+		if len(writeBuffer) >= packetHeaderSize {
 			// 有足够的连续空间可写,则直接写入RingBuffer里
 			// 省掉了一次内存分配操作: make([]byte, PacketHeaderSize)
 			packetHeader.WriteTo(writeBuffer)
@@ -97,22 +182,7 @@ func (this *RingBufferCodec) Encode(connection Connection, packet Packet) []byte
 				return remainData
 			}
 		}
-		writeBuffer = sendBuffer.WriteBuffer()
-		writedDataLen := 0
-		for i,data := range encodedData {
-			writed,_ := sendBuffer.Write(data)
-			writedDataLen += writed
-			if writed < len(data) {
-				// 写不下的包体数据,返回给TcpConnection延后处理
-				remainData := make([]byte, encodedDataLen-writedDataLen)
-				n := copy(remainData, data[writed:])
-				for j := i+1; j < len(encodedData); j++ {
-					n += copy(remainData[n:], encodedData[j])
-				}
-				return remainData
-			}
-		}
-		return nil
+		return writeSendBuffer(sendBuffer, encodedData, encodedDataLen)
 	}
 
 	//// 不优化的方案,每个包都需要进行一次内存分配和拷贝
@@ -131,11 +201,102 @@ func (this *RingBufferCodec) Encode(connection Connection, packet Packet) []byte
 	return packet.GetStreamData()
 }
 
+// 把超出MaxPacketDataSize的数据包分片写入sendBuffer
+// 分片格式: Header|Data|Header|Data...
+// 除了最后一个分片,其他分片的包头都带有PacketFlagFragment标记
+// 写不下的分片数据不拷贝,放在TcpConnection.delaySendFragments里,由发包协程逐个写入sendBuffer
+func (this *RingBufferCodec) encodeFragments(tcpConnection *TcpConnection, packet Packet, encodedData [][]byte, encodedDataLen int) []byte {
+	fragmentCount := (encodedDataLen+MaxPacketDataSize-1)/MaxPacketDataSize
+	segments := make([][]byte, 0, fragmentCount*2+len(encodedData))
+	remainLen := encodedDataLen
+	for remainLen > 0 {
+		fragmentLen := remainLen
+		flags := uint8(0)
+		if fragmentLen > MaxPacketDataSize {
+			fragmentLen = MaxPacketDataSize
+			flags = PacketFlagFragment
+		}
+		remainLen -= fragmentLen
+		packetHeaderData := make([]byte, DefaultPacketHeaderSize)
+		NewDefaultPacketHeader(uint32(fragmentLen), flags).WriteTo(packetHeaderData)
+		if this.HeaderEncoder != nil {
+			this.HeaderEncoder(tcpConnection, packet, packetHeaderData)
+		}
+		segments = append(segments, packetHeaderData)
+		// 切分包体数据,不产生copy
+		for fragmentLen > 0 {
+			data := encodedData[0]
+			if len(data) > fragmentLen {
+				segments = append(segments, data[0:fragmentLen])
+				encodedData[0] = data[fragmentLen:]
+				fragmentLen = 0
+			} else {
+				segments = append(segments, data)
+				encodedData = encodedData[1:]
+				fragmentLen -= len(data)
+			}
+		}
+	}
+	tcpConnection.delaySendFragments = writeDelaySendData(tcpConnection.sendBuffer, segments)
+	return nil
+}
+
+// 把数据写入sendBuffer
+// 返回值:写不下的数据,返回给TcpConnection延后处理
+func writeSendBuffer(sendBuffer *RingBuffer, encodedData [][]byte, encodedDataLen int) []byte {
+	writedDataLen := 0
+	for i,data := range encodedData {
+		writed,_ := sendBuffer.Write(data)
+		writedDataLen += writed
+		if writed < len(data) {
+			remainData := make([]byte, encodedDataLen-writedDataLen)
+			n := copy(remainData, data[writed:])
+			for j := i+1; j < len(encodedData); j++ {
+				n += copy(remainData[n:], encodedData[j])
+			}
+			return remainData
+		}
+	}
+	return nil
+}
+
 func (this *RingBufferCodec) Decode(connection Connection, data []byte) (newPacket Packet, err error) {
 	if tcpConnection,ok := connection.(*TcpConnection); ok {
 		// TcpConnection用了RingBuffer,解码时,尽可能的不产生copy
 		recvBuffer := tcpConnection.recvBuffer
 		// 先解码包头
+		if tcpConnection.curReadPacketHeader == nil && this.HeaderLayout != nil {
+			// 自定义格式的包头,长度可能不固定
+			peekLen := recvBuffer.UnReadLength()
+			if peekLen == 0 {
+				return
+			}
+			if peekLen > len(tcpConnection.tmpReadPacketHeaderData) {
+				peekLen = len(tcpConnection.tmpReadPacketHeaderData)
+			}
+			packetHeaderData := recvBuffer.Peek(peekLen, tcpConnection.tmpReadPacketHeaderData)
+			layoutPacketHeader := tcpConnection.tmpReadPacketHeader.(*LayoutPacketHeader)
+			packetHeaderSize,headerErr := layoutPacketHeader.Decode(packetHeaderData)
+			if headerErr != nil {
+				return nil, headerErr
+			}
+			if packetHeaderSize == 0 {
+				if peekLen == len(tcpConnection.tmpReadPacketHeaderData) {
+					// 数据已经达到包头的最大长度,仍然解析不出包头
+					return nil, ErrPacketLength
+				}
+				// 包头数据还没收完整
+				return
+			}
+			if !layoutPacketHeader.checkSequence(&tcpConnection.sequence) {
+				return nil, ErrPacketHeaderSequence
+			}
+			recvBuffer.SetReaded(packetHeaderSize)
+			if this.HeaderDecoder != nil {
+				this.HeaderDecoder(connection, packetHeaderData[0:packetHeaderSize])
+			}
+			tcpConnection.curReadPacketHeader = layoutPacketHeader
+		}
 		if tcpConnection.curReadPacketHeader == nil {
 			packetHeaderSize := int(this.PacketHeaderSize())
 			if recvBuffer.UnReadLength() < packetHeaderSize {
@@ -174,8 +335,13 @@ func (this *RingBufferCodec) Decode(connection Connection, data []byte) (newPack
 			return nil, ErrPacketLengthExceed
 		}
 		var packetData []byte
-		// 数据包没有超出RingBuffer大小
-		if int(header.Len()) <= recvBuffer.Size() {
+		// 分片标记,只有DefaultPacketHeader支持
+		isFragment := false
+		if defaultPacketHeader,ok := header.(*DefaultPacketHeader); ok {
+			isFragment = defaultPacketHeader.Flags()&PacketFlagFragment != 0
+		}
+		if !isFragment && tcpConnection.bigPacketData == nil && int(header.Len()) <= recvBuffer.Size() {
+			// 数据包没有超出RingBuffer大小
 			if recvBuffer.UnReadLength() < int(header.Len()) {
 				// 包体数据还没收完整
 				return
@@ -183,35 +349,65 @@ func (this *RingBufferCodec) Decode(connection Connection, data []byte) (newPack
 			// 从RingBuffer中读取完整包体数据
 			packetData = recvBuffer.ReadFull(int(header.Len()))
 		} else {
-			// 数据包超出了RingBuffer大小
+			// 数据包超出了RingBuffer大小,或者是分片的数据包
 			// 为什么要处理数据包超出RingBuffer大小的情况?
 			// 因为RingBuffer是一种内存换时间的解决方案,对于处理大量连接的应用场景,内存也是要考虑的因素
 			// 有一些应用场景,大部分数据包都不大,但是有少量数据包非常大,如果RingBuffer必须设置的比最大数据包还要大,可能消耗过多内存
-
-			// 剩余的包体数据,RingBuffer里面可能已经收了一部分包体数据
-			remainDataSize := int(header.Len())  - recvBuffer.UnReadLength()
-			remainData := make([]byte, remainDataSize)
-			// 阻塞读取剩余的包体数据
-			readLen,_ := io.ReadFull(tcpConnection.conn, remainData)
-			if readLen != remainDataSize {
-				return nil,ErrReadRemainPacket
-			}
-			if recvBuffer.UnReadLength() == 0 {
-				// 包体数据全部是从io.ReadFull读取到的
-				packetData = remainData
-			} else {
-				// 有一部分数据在RingBuffer里面,重组数据
-				packetData = make([]byte, header.Len())
-				dataInRingBuffer := recvBuffer.ReadFull(recvBuffer.UnReadLength())
-				// 先拷贝RingBuffer里面已经收到的一部分包体数据
-				n := copy(packetData, dataInRingBuffer)
-				// 再拷贝io.ReadFull读取到的
-				copy(packetData[n:], remainData)
+			// 这里不阻塞读取,每次把RingBuffer里已经收到的数据拷贝出来,直到收完整
+			if tcpConnection.bigPacketData == nil {
+				tcpConnection.bigPacketData = make([]byte, 0, header.Len())
+			}
+			if tcpConnection.bigPacketFrameRead == 0 && tcpConnection.config.MaxPacketSize > 0 &&
+				uint64(len(tcpConnection.bigPacketData))+uint64(header.Len()) > uint64(tcpConnection.config.MaxPacketSize) {
+				// 分片重组后的数据包长度超出设置
+				return nil, ErrPacketLengthExceed
+			}
+			for tcpConnection.bigPacketFrameRead < int(header.Len()) && recvBuffer.UnReadLength() > 0 {
+				readBuffer := recvBuffer.ReadBuffer()
+				readLen := int(header.Len()) - tcpConnection.bigPacketFrameRead
+				if readLen > len(readBuffer) {
+					readLen = len(readBuffer)
+				}
+				tcpConnection.bigPacketData = append(tcpConnection.bigPacketData, readBuffer[0:readLen]...)
+				recvBuffer.SetReaded(readLen)
+				tcpConnection.bigPacketFrameRead += readLen
+			}
+			if tcpConnection.bigPacketFrameRead < int(header.Len()) {
+				// 包体数据还没收完整
+				return
+			}
+			tcpConnection.bigPacketFrameRead = 0
+			if isFragment {
+				// 还有后续的分片,继续解码下一个分片
+				tcpConnection.curReadPacketHeader = nil
+				return this.Decode(connection, data)
+			}
+			packetData = tcpConnection.bigPacketData
+			tcpConnection.bigPacketData = nil
+		}
+		if this.Sequence != nil {
+			var recvSequence uint32
+			var sequenceErr error
+			var headerData []byte
+			if layoutPacketHeader,ok := header.(*LayoutPacketHeader); ok {
+				headerData = layoutPacketHeader.fieldsExceptLen()
+			}
+			packetData,recvSequence,sequenceErr = this.Sequence.decode(connection, &tcpConnection.sequence, headerData, packetData)
+			if sequenceErr != nil {
+				tcpConnection.curReadPacketHeader = nil
+				if this.Sequence.OnViolation != nil &&
+					this.Sequence.OnViolation(connection, sequenceErr, tcpConnection.sequence.recvSequence+1, recvSequence) {
+					// 丢弃该数据包,继续解码后面的数据包
+					return this.Decode(connection, data)
+				}
+				return nil, sequenceErr
 			}
 		}
 		if this.DataDecoder != nil {
 			// 包体的解码接口
 			newPacket = this.DataDecoder(connection, header, packetData)
+		} else if this.HeaderLayout != nil && this.HeaderLayout.HasCommand() {
+			newPacket = NewBigDataPacket(uint16(this.toLocalCommand(connection, header.(*LayoutPacketHeader).Command())), packetData)
 		} else {
 			newPacket = NewDataPacket(packetData)
 		}
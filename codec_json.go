@@ -0,0 +1,177 @@
+package gnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// json格式的数据包
+// {"command":123,"message":{...}}
+type jsonPacket struct {
+	Command PacketCommand   `json:"command"`
+	Message json.RawMessage `json:"message"`
+}
+
+// 消息号+protojson的编解码,用于GM工具和调试
+// 可以和ProtoCodec共用同一个消息注册表,从而在另一个调试端口上,使用同一个DefaultConnectionHandler
+// 支持2种分包格式:
+//  Length+Json: 和ProtoCodec一样使用DefaultPacketHeader
+//  Json+'\n': 每行一个数据包,便于telnet,nc等工具直接收发
+type JsonCodec struct {
+	RingBufferCodec
+
+	// 是否使用换行符分包
+	NewLineFraming bool
+
+	// 消息号和proto.Message构造函数的映射表
+	MessageCreatorMap map[PacketCommand]ProtoMessageCreator
+
+	// 使用换行符分包时,会强制单行输出(Multiline=false,Indent="")
+	MarshalOptions   protojson.MarshalOptions
+	UnmarshalOptions protojson.UnmarshalOptions
+}
+
+// messageCreatorMap可以直接使用ProtoCodec.MessageCreatorMap,共用消息注册表
+func NewJsonCodec(messageCreatorMap map[PacketCommand]ProtoMessageCreator, newLineFraming bool) *JsonCodec {
+	codec := &JsonCodec{
+		NewLineFraming:    newLineFraming,
+		MessageCreatorMap: messageCreatorMap,
+		UnmarshalOptions:  protojson.UnmarshalOptions{DiscardUnknown: true},
+	}
+	if codec.MessageCreatorMap == nil {
+		codec.MessageCreatorMap = make(map[PacketCommand]ProtoMessageCreator)
+	}
+	codec.DataEncoder = codec.EncodePacket
+	codec.DataDecoder = codec.DecodePacket
+	return codec
+}
+
+// 注册消息
+func (this *JsonCodec) Register(command PacketCommand, creator ProtoMessageCreator) {
+	this.MessageCreatorMap[command] = creator
+}
+
+// 注销消息
+func (this *JsonCodec) Unregister(command PacketCommand) {
+	delete(this.MessageCreatorMap, command)
+}
+
+func (this *JsonCodec) Encode(connection Connection, packet Packet) []byte {
+	if !this.NewLineFraming {
+		return this.RingBufferCodec.Encode(connection, packet)
+	}
+	encodedData := this.EncodePacket(connection, packet)
+	if encodedData == nil {
+		return nil
+	}
+	encodedData = append(encodedData, []byte{'\n'})
+	encodedDataLen := 0
+	for _, data := range encodedData {
+		encodedDataLen += len(data)
+	}
+	if tcpConnection, ok := connection.(*TcpConnection); ok {
+		return writeSendBuffer(tcpConnection.sendBuffer, encodedData, encodedDataLen)
+	}
+	return bytes.Join(encodedData, nil)
+}
+
+func (this *JsonCodec) Decode(connection Connection, data []byte) (newPacket Packet, err error) {
+	if !this.NewLineFraming {
+		return this.RingBufferCodec.Decode(connection, data)
+	}
+	if tcpConnection, ok := connection.(*TcpConnection); ok {
+		recvBuffer := tcpConnection.recvBuffer
+		for {
+			lineLen := recvBuffer.IndexByte('\n')
+			if lineLen < 0 {
+				if tcpConnection.config.MaxPacketSize > 0 && recvBuffer.UnReadLength() > int(tcpConnection.config.MaxPacketSize) {
+					return nil, ErrPacketLengthExceed
+				}
+				// recvBuffer已经写满了,仍然没有换行符,这一行永远也收不完整了
+				// 换行符分包不支持超出RecvBufferSize的数据包
+				if recvBuffer.UnReadLength() >= recvBuffer.Size() {
+					return nil, ErrPacketLengthExceed
+				}
+				// 一行数据还没收完整
+				return nil, nil
+			}
+			line := recvBuffer.ReadFull(lineLen + 1)
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			// 调试用的编解码,格式错误的行直接忽略,不断开连接
+			if newPacket = this.DecodePacket(connection, nil, line); newPacket != nil {
+				return newPacket, nil
+			}
+		}
+	}
+	return nil, ErrNotSupport
+}
+
+// 编码成: {"command":123,"message":{...}}
+func (this *JsonCodec) EncodePacket(connection Connection, packet Packet) [][]byte {
+	protoMessage := packet.Message()
+	if protoMessage == nil {
+		// 没有注册的消息号,无法知道消息格式,不能编码成"null"让对方误以为是空消息
+		messageCreator, ok := this.MessageCreatorMap[packet.Command()]
+		if !ok || messageCreator == nil {
+			logger.Error("json encode unsupport command:%v", packet.Command())
+			return nil
+		}
+		if len(packet.GetStreamData()) > 0 {
+			// 提前序列化好的proto数据,先反序列化
+			protoMessage = messageCreator()
+			if err := proto.Unmarshal(packet.GetStreamData(), protoMessage); err != nil {
+				logger.Error("proto decode err:%v cmd:%v", err, packet.Command())
+				return nil
+			}
+		}
+	}
+	messageBytes := []byte("null")
+	if protoMessage != nil {
+		marshalOptions := this.MarshalOptions
+		if this.NewLineFraming {
+			// 多行输出会破坏换行符分包
+			marshalOptions.Multiline = false
+			marshalOptions.Indent = ""
+		}
+		var err error
+		messageBytes, err = marshalOptions.Marshal(protoMessage)
+		if err != nil {
+			logger.Error("json encode err:%v cmd:%v", err, packet.Command())
+			return nil
+		}
+	}
+	commandBytes := []byte(`{"command":` + strconv.Itoa(int(packet.Command())) + `,"message":`)
+	return [][]byte{commandBytes, messageBytes, []byte("}")}
+}
+
+func (this *JsonCodec) DecodePacket(connection Connection, packetHeader PacketHeader, packetData []byte) Packet {
+	jsonPacketData := &jsonPacket{}
+	if err := json.Unmarshal(packetData, jsonPacketData); err != nil {
+		logger.Error("json decode err:%v", err)
+		return nil
+	}
+	command := jsonPacketData.Command
+	messageCreator, ok := this.MessageCreatorMap[command]
+	if !ok || messageCreator == nil {
+		logger.Error("unsupport command:%v", command)
+		return nil
+	}
+	newProtoMessage := messageCreator()
+	if len(jsonPacketData.Message) > 0 && string(jsonPacketData.Message) != "null" {
+		if err := this.UnmarshalOptions.Unmarshal(jsonPacketData.Message, newProtoMessage); err != nil {
+			logger.Error("json decode err:%v cmd:%v", err, command)
+			return nil
+		}
+	}
+	return &ProtoPacket{
+		command: command,
+		message: newProtoMessage,
+	}
+}
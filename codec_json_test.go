@@ -0,0 +1,73 @@
+package gnet
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestJsonCodec(t *testing.T) {
+	// 和ProtoCodec共用消息注册表
+	protoCodec := NewProtoCodec(nil)
+	handler := NewDefaultConnectionHandler(protoCodec)
+	handler.Register(1, nil, func() proto.Message {
+		return &wrapperspb.StringValue{}
+	})
+	config := &ConnectionConfig{SendBufferSize: 64, RecvBufferSize: 64, MaxPacketSize: 60}
+	for _, newLineFraming := range []bool{false, true} {
+		codec := NewJsonCodec(protoCodec.MessageCreatorMap, newLineFraming)
+		sender, receiver := newCodecTestConnections(codec, config)
+		codec.Encode(sender, NewProtoPacket(1, wrapperspb.String("hello json")))
+		transferCodecTestData(sender, receiver)
+		packet, err := codec.Decode(receiver, nil)
+		if err != nil || packet == nil || packet.Command() != 1 || packet.Message().(*wrapperspb.StringValue).GetValue() != "hello json" {
+			t.Fatalf("newLineFraming:%v packet:%v err:%v", newLineFraming, packet, err)
+		}
+	}
+
+	// 手动输入的数据,格式错误的行被忽略
+	codec := NewJsonCodec(protoCodec.MessageCreatorMap, true)
+	_, receiver := newCodecTestConnections(codec, config)
+	receiver.recvBuffer.Write([]byte("bad line\r\n\r\n{\"command\":1,\"message\":\"hi\"}\r\n{\"comm"))
+	packet, err := codec.Decode(receiver, nil)
+	if err != nil || packet == nil || packet.Message().(*wrapperspb.StringValue).GetValue() != "hi" {
+		t.Fatalf("packet:%v err:%v", packet, err)
+	}
+	if packet, err = codec.Decode(receiver, nil); packet != nil || err != nil {
+		t.Fatalf("packet:%v err:%v", packet, err)
+	}
+}
+
+func TestJsonCodecNewLineFraming(t *testing.T) {
+	codec := NewJsonCodec(nil, true)
+	codec.Register(1, func() proto.Message {
+		return &wrapperspb.StringValue{}
+	})
+	// 多行输出的设置不能破坏换行符分包
+	codec.MarshalOptions.Multiline = true
+	codec.MarshalOptions.Indent = "  "
+	config := &ConnectionConfig{SendBufferSize: 64, RecvBufferSize: 64, MaxPacketSize: 1024}
+	sender, receiver := newCodecTestConnections(codec, config)
+	codec.Encode(sender, NewProtoPacket(1, wrapperspb.String("multiline")))
+	transferCodecTestData(sender, receiver)
+	if packet, err := codec.Decode(receiver, nil); err != nil || packet == nil || packet.Message().(*wrapperspb.StringValue).GetValue() != "multiline" {
+		t.Fatalf("packet:%v err:%v", packet, err)
+	}
+
+	// 没有注册的消息号,编码失败
+	codec.Encode(sender, NewProtoPacketWithData(2, []byte{1, 2, 3}))
+	if sender.sendBuffer.UnReadLength() != 0 {
+		t.Fatalf("encode unregistered command:%v", sender.sendBuffer.UnReadLength())
+	}
+
+	// 超出RecvBufferSize但是没超出MaxPacketSize的一行
+	longLine := make([]byte, 64)
+	for i := range longLine {
+		longLine[i] = 'a'
+	}
+	receiver.recvBuffer.Write(longLine)
+	if _, err := codec.Decode(receiver, nil); err != ErrPacketLengthExceed {
+		t.Fatalf("err:%v", err)
+	}
+}
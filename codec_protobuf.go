@@ -44,11 +44,20 @@ func (this *ProtoCodec) Register(command PacketCommand, creator ProtoMessageCrea
 	this.MessageCreatorMap[command] = creator
 }
 
+// 注销消息
+func (this *ProtoCodec) Unregister(command PacketCommand) {
+	delete(this.MessageCreatorMap, command)
+}
+
 func (this *ProtoCodec) EncodePacket(connection Connection, packet Packet) [][]byte {
 	protoMessage := packet.Message()
-	// 先写入消息号
-	commandBytes := make([]byte,2)
-	binary.LittleEndian.PutUint16(commandBytes, uint16(packet.Command()))
+	var commandBytes []byte
+	// 包头里已经有消息号了,包体里就不用再写入消息号
+	if this.HeaderLayout == nil || !this.HeaderLayout.HasCommand() {
+		// 先写入消息号
+		commandBytes = make([]byte,2)
+		binary.LittleEndian.PutUint16(commandBytes, uint16(this.toRemoteCommand(connection, packet.Command())))
+	}
 	var messageBytes []byte
 	if protoMessage != nil {
 		var err error
@@ -78,14 +87,22 @@ func (this *ProtoCodec) DecodePacket(connection Connection, packetHeader PacketH
 	if this.ProtoPacketBytesDecoder != nil {
 		decodedPacketData = this.ProtoPacketBytesDecoder(packetData)
 	}
-	if len(decodedPacketData) < 2 {
-		return nil
+	var command uint16
+	if layoutPacketHeader,ok := packetHeader.(*LayoutPacketHeader); ok && this.HeaderLayout != nil && this.HeaderLayout.HasCommand() {
+		// 消息号在包头里
+		command = uint16(layoutPacketHeader.Command())
+	} else {
+		if len(decodedPacketData) < 2 {
+			return nil
+		}
+		command = binary.LittleEndian.Uint16(decodedPacketData[:2])
+		decodedPacketData = decodedPacketData[2:]
 	}
-	command := binary.LittleEndian.Uint16(decodedPacketData[:2])
+	command = uint16(this.toLocalCommand(connection, PacketCommand(command)))
 	if messageCreator,ok := this.MessageCreatorMap[PacketCommand(command)]; ok {
 		if messageCreator != nil {
 			newProtoMessage := messageCreator()
-			err := proto.Unmarshal(decodedPacketData[2:], newProtoMessage)
+			err := proto.Unmarshal(decodedPacketData, newProtoMessage)
 			if err != nil {
 				logger.Error("proto decode err:%v cmd:%v", err, command)
 				return nil
@@ -98,7 +115,7 @@ func (this *ProtoCodec) DecodePacket(connection Connection, packetHeader PacketH
 			// 支持只注册了消息号,没注册proto结构体的用法
 			return &ProtoPacket{
 				command: PacketCommand(command),
-				data: decodedPacketData[2:],
+				data: decodedPacketData,
 			}
 		}
 	}
@@ -0,0 +1,106 @@
+package gnet
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	// 消息号枚举类型名的前缀,如CmdTest
+	CommandEnumPrefix = "Cmd"
+	// 消息号枚举值名的前缀,如Cmd_TestMessage
+	CommandValuePrefix = "Cmd_"
+)
+
+// 消息号和消息的对应关系
+type CommandMessage struct {
+	// 消息号
+	Command PacketCommand
+	// 枚举值全名,如test.Cmd_TestMessage
+	EnumValue protoreflect.FullName
+	// 消息类型
+	MessageType protoreflect.MessageType
+}
+
+// 遍历protoregistry.GlobalFiles中指定package的消息号枚举,找出消息号对应的消息
+// 消息号枚举的命名规范: 枚举类型名以Cmd开头,枚举值名为Cmd_MessageName,值为0的枚举值会被忽略
+// messageSuffixes: 依次尝试MessageName+suffix,如服务器可以传入"","Req",客户端可以传入"","Res"
+// 不传messageSuffixes时,只匹配同名的消息
+// 返回值mismatches: 不符合命名规范,找不到对应消息,消息号重复等问题
+func FindCommandMessages(packageName protoreflect.FullName, messageSuffixes ...string) (commandMessages []*CommandMessage, mismatches []error) {
+	if len(messageSuffixes) == 0 {
+		messageSuffixes = []string{""}
+	}
+	commandNames := make(map[PacketCommand]protoreflect.FullName)
+	protoregistry.GlobalFiles.RangeFilesByPackage(packageName, func(fileDescriptor protoreflect.FileDescriptor) bool {
+		enums := fileDescriptor.Enums()
+		for i := 0; i < enums.Len(); i++ {
+			enumDescriptor := enums.Get(i)
+			if !strings.HasPrefix(string(enumDescriptor.Name()), CommandEnumPrefix) {
+				continue
+			}
+			values := enumDescriptor.Values()
+			for j := 0; j < values.Len(); j++ {
+				valueDescriptor := values.Get(j)
+				if valueDescriptor.Number() == 0 {
+					continue
+				}
+				valueName := string(valueDescriptor.Name())
+				if !strings.HasPrefix(valueName, CommandValuePrefix) {
+					mismatches = append(mismatches, fmt.Errorf("%v not start with %v", valueDescriptor.FullName(), CommandValuePrefix))
+					continue
+				}
+				if valueDescriptor.Number() < 0 || valueDescriptor.Number() > 0xFFFF {
+					mismatches = append(mismatches, fmt.Errorf("%v command out of range:%v", valueDescriptor.FullName(), valueDescriptor.Number()))
+					continue
+				}
+				command := PacketCommand(valueDescriptor.Number())
+				if existName, ok := commandNames[command]; ok {
+					mismatches = append(mismatches, fmt.Errorf("%v command %v duplicate with %v", valueDescriptor.FullName(), command, existName))
+					continue
+				}
+				messageName := strings.TrimPrefix(valueName, CommandValuePrefix)
+				var messageType protoreflect.MessageType
+				for _, suffix := range messageSuffixes {
+					messageFullName := packageName.Append(protoreflect.Name(messageName + suffix))
+					if packageName == "" {
+						messageFullName = protoreflect.FullName(messageName + suffix)
+					}
+					if findType, err := protoregistry.GlobalTypes.FindMessageByName(messageFullName); err == nil {
+						messageType = findType
+						break
+					}
+				}
+				if messageType == nil {
+					mismatches = append(mismatches, fmt.Errorf("%v no message found, suffixes:%q", valueDescriptor.FullName(), messageSuffixes))
+					continue
+				}
+				commandNames[command] = valueDescriptor.FullName()
+				commandMessages = append(commandMessages, &CommandMessage{
+					Command:     command,
+					EnumValue:   valueDescriptor.FullName(),
+					MessageType: messageType,
+				})
+			}
+		}
+		return true
+	})
+	return
+}
+
+// 根据消息号枚举的命名规范,一次性注册指定package的所有消息
+// 符合规范的消息都会注册,不符合规范的通过mismatches返回
+func AutoRegisterCommands(protoRegister ProtoRegister, packageName protoreflect.FullName, messageSuffixes ...string) (mismatches []error) {
+	commandMessages, mismatches := FindCommandMessages(packageName, messageSuffixes...)
+	for _, commandMessage := range commandMessages {
+		messageType := commandMessage.MessageType
+		protoRegister.Register(commandMessage.Command, func() proto.Message {
+			return messageType.New().Interface()
+		})
+	}
+	return mismatches
+}
@@ -28,9 +28,40 @@ type Connection interface {
 	// 超时发包,超时未发送则丢弃,适用于某些允许丢弃的数据包
 	TrySendPacket(packet Packet, timeout time.Duration) bool
 
-	// 是否连接成功
+	// 按优先级发包,高优先级的数据包优先发送
+	// NOTE:调用SendPacketWithPriority(packet,priority)之后,不要再对packet进行读写!
+	SendPacketWithPriority(packet Packet, priority SendPriority) bool
+
+	// 合并发送,同一个coalesceKey的数据包还在发包缓存里没有发送时,新的数据包会替换旧的数据包
+	// 适用于只关心最新状态的数据包,如血量同步,位置同步
+	// NOTE:调用SendPacketCoalesce(packet,coalesceKey)之后,不要再对packet进行读写!
+	SendPacketCoalesce(packet Packet, coalesceKey uint64) bool
+
+	// 异步发送数据,数据包写入socket成功或失败后回调onDelivered
+	// NOTE:调用SendPacketWithCallback(packet,priority,onDelivered)之后,不要再对packet进行读写!
+	SendPacketWithCallback(packet Packet, priority SendPriority, onDelivered DeliveryCallback) bool
+
+	// 等待发包缓存和发送缓存里的数据都写入socket
+	Flush(ctx context.Context) error
+
+	// 是否连接成功(包括正在优雅关闭的状态)
 	IsConnected() bool
 
+	// 连接状态
+	State() ConnectionState
+
+	// 暂停读取,用于上层处理不过来时的背压
+	PauseRead()
+
+	// 恢复读取
+	ResumeRead()
+
+	// 是否暂停读取
+	IsReadPaused() bool
+
+	// 收包队列统计,没有设置收包队列时返回空的统计
+	GetInboundQueueStats() InboundQueueStats
+
 	// 获取编解码接口
 	GetCodec() Codec
 
@@ -48,12 +79,29 @@ type Connection interface {
 	// 关闭连接
 	Close()
 
+	// 连接关闭原因,连接还没关闭时返回nil
+	GetCloseReason() *CloseReason
+
+	// 优雅关闭:不再接受新的发包,等待已有的数据发送完,关闭写端,等待对方关闭连接或者超时
+	// 异步执行,关闭完成后会调用OnDisconnected
+	CloseGracefully(timeout time.Duration)
+
 	// 获取关联数据
 	GetTag() interface{}
 
 	// 设置关联数据
 	SetTag(tag interface{})
 
+	// 并发安全的属性表,一般通过Attr[T]访问
+	Attributes() *Attributes
+
+	// 连接的context,连接关闭时cancel
+	// 可以通过ConnectionFromContext,ConnectionIdFromContext,RemoteAddrFromContext获取连接信息
+	Context() context.Context
+
+	// 设置连接的context的自定义值
+	SetContextValue(key, value interface{})
+
 	Connect(address string) bool
 
 	Start(ctx context.Context, netMgrWg *sync.WaitGroup, onClose func(connection Connection))
@@ -62,6 +110,8 @@ type Connection interface {
 // 连接设置
 type ConnectionConfig struct {
 	// 发包缓存chan大小(缓存数据包chan容量)
+	// NOTE:每个发包优先级(SendPriority)都有一个这么大的发包缓存,所以每个连接最多缓存SendPacketCacheCap*SendPriorityCount个数据包,
+	// SendOverflowPolicy也是按单个优先级的发包缓存是否满来判断的
 	SendPacketCacheCap uint32
 	// 发包Buffer大小(byte)
 	// 不能小于PacketHeaderSize
@@ -71,6 +121,8 @@ type ConnectionConfig struct {
 	RecvBufferSize uint32
 	// 最大包体大小设置(byte),不包含PacketHeader
 	// 允许该值大于SendBufferSize和RecvBufferSize
+	// TcpConnection支持最大4G的数据包,超过16M的数据包会自动分片
+	// TcpConnection的默认值是16M,收发超过16M的数据包时,收发双方都需要设置更大的值,否则收包方会因为ErrPacketLengthExceed断开连接
 	MaxPacketSize uint32
 	// 收包超时设置(秒)
 	RecvTimeout uint32
@@ -79,6 +131,27 @@ type ConnectionConfig struct {
 	// 发包超时设置(秒)
 	// net.Conn.SetWriteDeadline
 	WriteTimeout uint32
+	// 收包限速设置,为nil时不限速
+	RecvRateLimit *RecvRateLimitConfig
+	// 发包限速设置,为nil时不限速
+	SendBandwidth *SendBandwidthConfig
+	// 发包缓存满时的处理方式,默认阻塞
+	SendOverflowPolicy SendOverflowPolicy
+	// SendOverflowBlockTimeout的超时时间(毫秒)
+	SendOverflowTimeout uint32
+	// 发包缓存满时,丢弃数据包或断开连接的回调
+	OnSendOverflow SendOverflowHandler
+	// 连接状态变化事件,可以作为ConnectionHandler和ListenerHandler的替代,为nil时不发送
+	// 不会阻塞网络层,chan满时事件会被丢弃
+	// connector从Connecting开始,连接成功时发送Connecting->Connected,连接失败时发送Connecting->Closed(CloseCodeConnectFailed)
+	// accept的连接创建时就是Connected,不发送Connected事件
+	StateEvents chan<- ConnectionStateEvent
+	// 收包队列设置,为nil时在收包协程里直接调用handler.OnRecvPacket
+	InboundQueue *InboundQueueConfig
+	// 收包背压设置,为nil时不会自动暂停读取
+	ReadBackpressure *ReadBackpressureConfig
+	// 低优先级的数据包最多被高优先级跳过的次数,超过后优先发送一次,为0时使用DefaultSendPriorityStarveLimit
+	SendPriorityStarveLimit uint32
 	// TODO:其他流量控制设置
 }
 
@@ -90,14 +163,39 @@ type baseConnection struct {
 	config *ConnectionConfig
 	// 是否是连接方
 	isConnector bool
-	// 是否连接成功
-	isConnected bool
+	// 连接状态ConnectionState
+	state int32
 	// 接口
 	handler ConnectionHandler
 	// 编解码接口
 	codec Codec
-	// 关联数据
-	tag interface{}
+	// 关联数据,存放的是*connectionTag
+	tag atomic.Value
+	// 数据包序列号(防重放)
+	sequence packetSequence
+	// 收包限速
+	recvRateLimiter *recvRateLimiter
+	// 发包限速
+	sendLimiter *sendBandwidthLimiter
+	// 发包缓存满而丢弃数据包或断开连接的次数
+	sendOverflowCount uint32
+	// 多个优先级的发包缓存
+	sendLanes sendPriorityLanes
+	// 发送结果回调
+	delivery sendDeliveryTracker
+	// 连接关闭时close
+	closeNotify chan struct{}
+	// 连接关闭原因
+	closeReason *CloseReason
+	closeReasonLock sync.Mutex
+	// 连接的context
+	ctx *connectionContext
+	// 属性表
+	attributes Attributes
+	// 暂停读取
+	readPause readPauseControl
+	// 收包队列
+	inboundQueue *inboundQueue
 }
 
 // 连接唯一id
@@ -109,9 +207,10 @@ func (this *baseConnection) IsConnector() bool {
 	return this.isConnector
 }
 
-// 是否连接成功
+// 是否连接成功(包括正在优雅关闭的状态)
 func (this *baseConnection) IsConnected() bool {
-	return this.isConnected
+	state := this.State()
+	return state == ConnectionStateConnected || state == ConnectionStateClosing
 }
 
 // 获取编解码接口
@@ -126,17 +225,39 @@ func (this *baseConnection) SetCodec(codec Codec) {
 
 // 获取关联数据
 func (this *baseConnection) GetTag() interface{} {
-	return this.tag
+	if tag, ok := this.tag.Load().(*connectionTag); ok {
+		return tag.value
+	}
+	return nil
 }
-// 设置关联数据
+// 设置关联数据,可以在多个协程中调用
 func (this *baseConnection) SetTag(tag interface{}) {
-	this.tag = tag
+	// atomic.Value不能存放nil和不同类型的值,所以包装一层
+	this.tag.Store(&connectionTag{value: tag})
+}
+
+// 关联数据的包装
+type connectionTag struct {
+	value interface{}
 }
 
 func (this *baseConnection) GetHandler() ConnectionHandler {
 	return this.handler
 }
 
+// 设置TcpListener共享的发包限速
+func (this *baseConnection) setListenerSendBucket(bucket *tokenBucket) {
+	if this.sendLimiter == nil {
+		this.sendLimiter = newSendBandwidthLimiter(&SendBandwidthConfig{})
+	}
+	this.sendLimiter.listenerBucket = bucket
+}
+
+// 支持TcpListener共享发包限速的连接
+type listenerSendBucketSetter interface {
+	setListenerSendBucket(bucket *tokenBucket)
+}
+
 var (
 	connectionIdCounter uint32 = 0
 )
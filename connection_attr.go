@@ -0,0 +1,130 @@
+package gnet
+
+import (
+	"sync"
+)
+
+// 连接的属性表,并发安全
+// 可以给多个模块使用(如登录,公会,反作弊),key一般使用Attr[T],避免互相冲突
+type Attributes struct {
+	lock   sync.RWMutex
+	values map[interface{}]interface{}
+}
+
+// 获取属性
+func (this *Attributes) Load(key interface{}) (value interface{}, ok bool) {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	value, ok = this.values[key]
+	return
+}
+
+// 设置属性,返回旧值
+func (this *Attributes) Swap(key, value interface{}) (oldValue interface{}, loaded bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.values == nil {
+		this.values = make(map[interface{}]interface{})
+	}
+	oldValue, loaded = this.values[key]
+	this.values[key] = value
+	return
+}
+
+// 删除属性,返回旧值
+func (this *Attributes) Delete(key interface{}) (oldValue interface{}, loaded bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	oldValue, loaded = this.values[key]
+	delete(this.values, key)
+	return
+}
+
+// 遍历属性,f返回false时停止遍历
+// NOTE:f里面不能再修改属性
+func (this *Attributes) Range(f func(key, value interface{}) bool) {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	for key, value := range this.values {
+		if !f(key, value) {
+			return
+		}
+	}
+}
+
+// 连接的属性表
+func (this *baseConnection) Attributes() *Attributes {
+	return &this.attributes
+}
+
+// 类型安全的连接属性key,每个NewAttr返回的key都是唯一的
+//  var PlayerIdAttr = NewAttr[int64]("playerId")
+//  PlayerIdAttr.Set(connection, 123)
+//  playerId,ok := PlayerIdAttr.Get(connection)
+type Attr[T any] struct {
+	name string
+	// 属性设置后的回调
+	onSet func(connection Connection, oldValue, newValue T)
+	// 属性删除后的回调
+	onDelete func(connection Connection, oldValue T)
+}
+
+func NewAttr[T any](name string) *Attr[T] {
+	return &Attr[T]{name: name}
+}
+
+// 属性名,用于调试
+func (this *Attr[T]) Name() string {
+	return this.name
+}
+
+func (this *Attr[T]) String() string {
+	return this.name
+}
+
+// 设置属性设置后的回调,oldValue:没有旧值时是T的零值
+// 回调在调用Set的协程中执行
+func (this *Attr[T]) OnSet(onSet func(connection Connection, oldValue, newValue T)) *Attr[T] {
+	this.onSet = onSet
+	return this
+}
+
+// 设置属性删除后的回调,只在删除了已有的属性时调用,Delete不会调用OnSet设置的回调
+// 回调在调用Delete的协程中执行
+func (this *Attr[T]) OnDelete(onDelete func(connection Connection, oldValue T)) *Attr[T] {
+	this.onDelete = onDelete
+	return this
+}
+
+// 获取属性
+func (this *Attr[T]) Get(connection Connection) (value T, ok bool) {
+	var v interface{}
+	if v, ok = connection.Attributes().Load(this); ok {
+		value, ok = v.(T)
+	}
+	return
+}
+
+// 获取属性,没有时返回T的零值
+func (this *Attr[T]) GetOrZero(connection Connection) T {
+	value, _ := this.Get(connection)
+	return value
+}
+
+// 设置属性
+func (this *Attr[T]) Set(connection Connection, value T) {
+	oldValue, _ := connection.Attributes().Swap(this, value)
+	if this.onSet != nil {
+		typedOldValue, _ := oldValue.(T)
+		this.onSet(connection, typedOldValue, value)
+	}
+}
+
+// 删除属性
+func (this *Attr[T]) Delete(connection Connection) {
+	oldValue, loaded := connection.Attributes().Delete(this)
+	if loaded && this.onDelete != nil {
+		typedOldValue, _ := oldValue.(T)
+		this.onDelete(connection, typedOldValue)
+	}
+}
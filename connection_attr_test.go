@@ -0,0 +1,93 @@
+package gnet
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestConnectionAttr(t *testing.T) {
+	connection := NewTcpConnector(&ConnectionConfig{SendPacketCacheCap: 1}, NewDefaultCodec(), nil)
+	var setValues []int64
+	playerIdAttr := NewAttr[int64]("playerId").OnSet(func(connection Connection, oldValue, newValue int64) {
+		setValues = append(setValues, oldValue, newValue)
+	})
+	// 同名不同类型的属性互不影响
+	otherPlayerIdAttr := NewAttr[string]("playerId")
+	if _, ok := playerIdAttr.Get(connection); ok {
+		t.Fatal("attr exist")
+	}
+	playerIdAttr.Set(connection, 1)
+	playerIdAttr.Set(connection, 2)
+	otherPlayerIdAttr.Set(connection, "other")
+	if value, ok := playerIdAttr.Get(connection); !ok || value != 2 || otherPlayerIdAttr.GetOrZero(connection) != "other" {
+		t.Fatalf("value:%v", value)
+	}
+	if len(setValues) != 4 || setValues[0] != 0 || setValues[1] != 1 || setValues[2] != 1 || setValues[3] != 2 {
+		t.Fatalf("setValues:%v", setValues)
+	}
+	var deleteValues []int64
+	playerIdAttr.OnDelete(func(connection Connection, oldValue int64) {
+		deleteValues = append(deleteValues, oldValue)
+	})
+	playerIdAttr.Delete(connection)
+	if playerIdAttr.GetOrZero(connection) != 0 {
+		t.Fatal("delete failed")
+	}
+	// 没有属性时删除不会回调
+	playerIdAttr.Delete(connection)
+	if len(deleteValues) != 1 || deleteValues[0] != 2 || len(setValues) != 4 {
+		t.Fatalf("deleteValues:%v setValues:%v", deleteValues, setValues)
+	}
+
+	// 并发读写
+	counterAttr := NewAttr[int]("counter")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				counterAttr.Set(connection, i*j)
+				counterAttr.Get(connection)
+			}
+		}(i)
+	}
+	wg.Wait()
+	count := 0
+	connection.Attributes().Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	if count != 2 {
+		t.Fatalf("count:%v", count)
+	}
+}
+
+// SetTag和GetTag可以在多个协程中调用
+func TestConnectionTag(t *testing.T) {
+	connection := NewTcpConnector(&ConnectionConfig{SendPacketCacheCap: 1}, NewDefaultCodec(), nil)
+	if connection.GetTag() != nil {
+		t.Fatal("tag not nil")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				// 不同类型的tag
+				if j%2 == 0 {
+					connection.SetTag(i)
+				} else {
+					connection.SetTag("tag")
+				}
+				connection.GetTag()
+			}
+		}(i)
+	}
+	wg.Wait()
+	connection.SetTag(nil)
+	if connection.GetTag() != nil {
+		t.Fatal("tag not nil")
+	}
+}
@@ -0,0 +1,74 @@
+package gnet
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 是否可以发包:连接成功,并且没有在优雅关闭中
+func (this *baseConnection) canSend() bool {
+	return this.State() == ConnectionStateConnected
+}
+
+// 是否正在优雅关闭
+func (this *baseConnection) IsClosingGracefully() bool {
+	return this.State() == ConnectionStateClosing
+}
+
+// 优雅关闭
+// 不再接受新的发包,等待发包缓存和发送缓存里的数据都写入socket,
+// 然后关闭写端(TCP half-close),等待对方关闭连接(收到FIN)或者超时,最后关闭连接
+// 异步执行,不会阻塞调用者,关闭完成后会调用OnDisconnected
+func (this *baseConnection) closeGracefully(connection Connection, conn net.Conn, timeout time.Duration) {
+	if !this.compareAndSwapState(connection, ConnectionStateConnected, ConnectionStateClosing) {
+		if this.State() == ConnectionStateConnecting {
+			// 还没有连接成功,直接关闭
+			closeWithReason(connection, CloseCodeGraceful, nil)
+		}
+		return
+	}
+	this.setCloseReason(CloseCodeGraceful, nil)
+	if conn == nil {
+		connection.Close()
+		return
+	}
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error("closeGracefully fatal %v: %v", this.GetConnectionId(), err)
+				LogStack()
+			}
+			connection.Close()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := connection.Flush(ctx); err != nil {
+			logger.Debug("closeGracefully %v flush err:%v", this.GetConnectionId(), err)
+			return
+		}
+		if closeWriter, ok := conn.(interface{ CloseWrite() error }); ok {
+			if err := closeWriter.CloseWrite(); err != nil {
+				logger.Debug("closeGracefully %v CloseWrite err:%v", this.GetConnectionId(), err)
+				return
+			}
+		}
+		// 等待对方关闭连接,收包协程读取到EOF后会关闭连接
+		select {
+		case <-this.closeNotify:
+		case <-ctx.Done():
+			logger.Debug("closeGracefully %v timeout", this.GetConnectionId())
+		}
+	}()
+}
+
+// 踢掉连接:先发送一个通知消息(如踢人原因),再优雅关闭连接
+// 通知消息使用高优先级发送,timeout是优雅关闭的超时时间
+func Kick(connection Connection, command PacketCommand, reason proto.Message, timeout time.Duration) {
+	if reason != nil {
+		connection.SendPacketWithPriority(NewProtoPacket(command, reason), SendPriorityHigh)
+	}
+	connection.CloseGracefully(timeout)
+}
@@ -0,0 +1,131 @@
+package gnet
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+type connectionContextKey struct{}
+
+// 连接的context
+// 在创建连接时就可以使用(如OnConnected),连接关闭时cancel
+// Start之后派生自Start传入的ctx:继承它的Deadline,它结束时也会cancel,Err返回它的错误
+// Value的查找顺序:连接对象,SetContextValue设置的自定义值,Start传入的ctx
+type connectionContext struct {
+	context.Context
+	cancel     context.CancelFunc
+	connection Connection
+	// 自定义值
+	values sync.Map
+	// Start传入的ctx
+	parent     context.Context
+	parentLock sync.RWMutex
+	// 因为Start传入的ctx结束而cancel时,记录它的错误
+	parentErr error
+}
+
+func newConnectionContext(connection Connection) *connectionContext {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &connectionContext{
+		Context:    ctx,
+		cancel:     cancel,
+		connection: connection,
+	}
+}
+
+func (this *connectionContext) Value(key interface{}) interface{} {
+	if key == (connectionContextKey{}) {
+		return this.connection
+	}
+	if value, ok := this.values.Load(key); ok {
+		return value
+	}
+	if parent := this.getParent(); parent != nil {
+		return parent.Value(key)
+	}
+	return this.Context.Value(key)
+}
+
+func (this *connectionContext) Deadline() (deadline time.Time, ok bool) {
+	if parent := this.getParent(); parent != nil {
+		return parent.Deadline()
+	}
+	return this.Context.Deadline()
+}
+
+func (this *connectionContext) Err() error {
+	err := this.Context.Err()
+	if err == nil {
+		return nil
+	}
+	this.parentLock.RLock()
+	defer this.parentLock.RUnlock()
+	if this.parentErr != nil {
+		return this.parentErr
+	}
+	return err
+}
+
+func (this *connectionContext) getParent() context.Context {
+	this.parentLock.RLock()
+	defer this.parentLock.RUnlock()
+	return this.parent
+}
+
+// 设置Start传入的ctx,Start传入的ctx结束时,直接cancel连接的context,
+// 不依赖发包协程(发包协程可能正阻塞在写socket或者发包限速上)
+func (this *connectionContext) setParent(parent context.Context) {
+	this.parentLock.Lock()
+	this.parent = parent
+	this.parentLock.Unlock()
+	if parent.Done() == nil {
+		return
+	}
+	go func() {
+		select {
+		case <-parent.Done():
+			this.parentLock.Lock()
+			if this.Context.Err() == nil {
+				this.parentErr = parent.Err()
+			}
+			this.parentLock.Unlock()
+			this.cancel()
+		case <-this.Context.Done():
+		}
+	}()
+}
+
+// 连接的context,连接关闭时cancel
+// 可以用来绑定和连接生命周期一致的协程或者rpc调用
+func (this *baseConnection) Context() context.Context {
+	return this.ctx
+}
+
+// 设置连接的context的自定义值
+func (this *baseConnection) SetContextValue(key, value interface{}) {
+	this.ctx.values.Store(key, value)
+}
+
+// 获取context关联的连接
+func ConnectionFromContext(ctx context.Context) (Connection, bool) {
+	connection, ok := ctx.Value(connectionContextKey{}).(Connection)
+	return connection, ok
+}
+
+// 获取context关联的连接id
+func ConnectionIdFromContext(ctx context.Context) (uint32, bool) {
+	if connection, ok := ConnectionFromContext(ctx); ok {
+		return connection.GetConnectionId(), true
+	}
+	return 0, false
+}
+
+// 获取context关联的连接的对方地址
+func RemoteAddrFromContext(ctx context.Context) net.Addr {
+	if connection, ok := ConnectionFromContext(ctx); ok {
+		return connection.RemoteAddr()
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package gnet
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type testContextKey struct{}
+
+type testStartContextKey struct{}
+
+func TestConnectionContext(t *testing.T) {
+	connection := NewTcpConnector(&ConnectionConfig{SendPacketCacheCap: 1}, NewDefaultCodec(), nil)
+	ctx := connection.Context()
+	if connectionId, ok := ConnectionIdFromContext(ctx); !ok || connectionId != connection.GetConnectionId() {
+		t.Fatalf("connectionId:%v", connectionId)
+	}
+	if RemoteAddrFromContext(ctx) != nil {
+		t.Fatal("RemoteAddr not nil")
+	}
+	connection.SetContextValue(testContextKey{}, "custom")
+	if ctx.Value(testContextKey{}) != "custom" {
+		t.Fatal("custom value")
+	}
+	// Start传入的ctx的值也可以获取
+	startCtx, cancel := context.WithCancel(context.WithValue(context.Background(), testStartContextKey{}, 1))
+	defer cancel()
+	connection.ctx.setParent(startCtx)
+	if ctx.Value(testStartContextKey{}) != 1 {
+		t.Fatal("start ctx value")
+	}
+	if ctx.Err() != nil {
+		t.Fatal("ctx done before close")
+	}
+	connection.Close()
+	<-ctx.Done()
+	if _, ok := ConnectionFromContext(context.Background()); ok {
+		t.Fatal("background ctx has connection")
+	}
+}
+
+// 连接的context派生自Start传入的ctx
+func TestConnectionContextParent(t *testing.T) {
+	connection := NewTcpConnector(&ConnectionConfig{SendPacketCacheCap: 1}, NewDefaultCodec(), nil)
+	ctx := connection.Context()
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("deadline before start")
+	}
+	deadline := time.Now().Add(time.Millisecond * 50)
+	startCtx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	connection.ctx.setParent(startCtx)
+	if ctxDeadline, ok := ctx.Deadline(); !ok || !ctxDeadline.Equal(deadline) {
+		t.Fatalf("deadline:%v", ctxDeadline)
+	}
+	// Start传入的ctx结束时,连接的context也结束,不需要等待连接关闭
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("ctx not done")
+	}
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Fatalf("err:%v", ctx.Err())
+	}
+
+	// 连接关闭时,Err是context.Canceled
+	connection = NewTcpConnector(&ConnectionConfig{SendPacketCacheCap: 1}, NewDefaultCodec(), nil)
+	startCtx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	connection.ctx.setParent(startCtx)
+	connection.Close()
+	if err := connection.Context().Err(); err != context.Canceled {
+		t.Fatalf("err:%v", err)
+	}
+}
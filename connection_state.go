@@ -0,0 +1,91 @@
+package gnet
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// 连接状态
+type ConnectionState int32
+
+const (
+	// 初始状态,connector还没有连接成功
+	ConnectionStateConnecting ConnectionState = iota
+	// 连接成功
+	ConnectionStateConnected
+	// 正在优雅关闭(CloseGracefully),不再接受新的发包
+	ConnectionStateClosing
+	// 已关闭
+	ConnectionStateClosed
+)
+
+func (this ConnectionState) String() string {
+	switch this {
+	case ConnectionStateConnecting:
+		return "Connecting"
+	case ConnectionStateConnected:
+		return "Connected"
+	case ConnectionStateClosing:
+		return "Closing"
+	case ConnectionStateClosed:
+		return "Closed"
+	}
+	return fmt.Sprintf("ConnectionState(%d)", int32(this))
+}
+
+// 连接状态变化事件
+type ConnectionStateEvent struct {
+	Connection Connection
+	OldState   ConnectionState
+	NewState   ConnectionState
+	// 关闭原因,只有NewState是ConnectionStateClosed时才有
+	Reason *CloseReason
+}
+
+// 连接状态
+func (this *baseConnection) State() ConnectionState {
+	return ConnectionState(atomic.LoadInt32(&this.state))
+}
+
+// 设置初始状态,不发送状态变化事件
+func (this *baseConnection) initState(state ConnectionState) {
+	atomic.StoreInt32(&this.state, int32(state))
+}
+
+// 设置连接状态,状态有变化时发送状态变化事件
+func (this *baseConnection) setState(connection Connection, newState ConnectionState) {
+	oldState := ConnectionState(atomic.SwapInt32(&this.state, int32(newState)))
+	if oldState != newState {
+		this.notifyStateEvent(connection, oldState, newState)
+	}
+}
+
+// 当前状态是oldState时,才设置成newState
+func (this *baseConnection) compareAndSwapState(connection Connection, oldState, newState ConnectionState) bool {
+	if !atomic.CompareAndSwapInt32(&this.state, int32(oldState), int32(newState)) {
+		return false
+	}
+	this.notifyStateEvent(connection, oldState, newState)
+	return true
+}
+
+// 发送状态变化事件到ConnectionConfig.StateEvents
+// 不会阻塞,chan满时事件会被丢弃
+func (this *baseConnection) notifyStateEvent(connection Connection, oldState, newState ConnectionState) {
+	if this.config.StateEvents == nil {
+		return
+	}
+	event := ConnectionStateEvent{
+		Connection: connection,
+		OldState:   oldState,
+		NewState:   newState,
+	}
+	if newState == ConnectionStateClosed {
+		event.Reason = this.GetCloseReason()
+	}
+	select {
+	case this.config.StateEvents <- event:
+	default:
+		logger.Error("%v StateEvents full, drop event %v->%v", this.GetConnectionId(), oldState, newState)
+	}
+}
@@ -0,0 +1,72 @@
+package gnet
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnectionState(t *testing.T) {
+	events := make(chan ConnectionStateEvent, 8)
+	config := &ConnectionConfig{SendPacketCacheCap: 1, StateEvents: events}
+	connection := NewTcpConnector(config, NewDefaultCodec(), nil)
+	if connection.State() != ConnectionStateConnecting || connection.IsConnected() {
+		t.Fatalf("state:%v", connection.State())
+	}
+	// 还没有连接成功时优雅关闭,直接关闭
+	connection.CloseGracefully(time.Second)
+	if connection.State() != ConnectionStateClosed || connection.SendPacket(NewDataPacket(nil)) {
+		t.Fatalf("state:%v", connection.State())
+	}
+	event := <-events
+	if event.Connection != connection || event.OldState != ConnectionStateConnecting || event.NewState != ConnectionStateClosed ||
+		event.Reason == nil || event.Reason.Code != CloseCodeGraceful {
+		t.Fatalf("event:%v", event)
+	}
+
+	connection = NewTcpConnector(config, NewDefaultCodec(), nil)
+	connection.setState(connection, ConnectionStateConnected)
+	// 没有socket的连接,优雅关闭时直接关闭
+	connection.CloseGracefully(time.Second)
+	connection.Close()
+	var states []ConnectionState
+	for len(events) > 0 {
+		states = append(states, (<-events).NewState)
+	}
+	if len(states) != 3 || states[0] != ConnectionStateConnected || states[1] != ConnectionStateClosing || states[2] != ConnectionStateClosed {
+		t.Fatalf("states:%v", states)
+	}
+}
+
+func TestConnectionStateConnect(t *testing.T) {
+	events := make(chan ConnectionStateEvent, 8)
+	config := &ConnectionConfig{SendPacketCacheCap: 1, StateEvents: events}
+	// accept的连接创建时就是Connected,不发送事件
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	for _, connection := range []Connection{NewTcpConnectionAccept(serverConn, config, NewDefaultCodec(), nil),
+		NewTcpConnectionNoRingAccept(serverConn, config, &CodecNoRing{}, nil)} {
+		if connection.State() != ConnectionStateConnected || len(events) != 0 {
+			t.Fatalf("state:%v events:%v", connection.State(), len(events))
+		}
+	}
+
+	// 连接失败
+	for _, connection := range []Connection{NewTcpConnector(config, NewDefaultCodec(), nil),
+		NewTcpConnectionNoRing(config, &CodecNoRing{}, nil)} {
+		if connection.Connect("127.0.0.1:1") {
+			t.Fatal("connect success")
+		}
+		event := <-events
+		if event.OldState != ConnectionStateConnecting || event.NewState != ConnectionStateClosed ||
+			event.Reason == nil || event.Reason.Code != CloseCodeConnectFailed || event.Reason.Err == nil {
+			t.Fatalf("event:%v", event)
+		}
+		// Close不会再发送事件
+		connection.Close()
+		if len(events) != 0 || connection.GetCloseReason().Code != CloseCodeConnectFailed {
+			t.Fatalf("events:%v", len(events))
+		}
+	}
+}
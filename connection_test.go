@@ -0,0 +1,13 @@
+package gnet
+
+// 创建一个没有socket的连接,状态直接设置为Connected
+// 不会开启收包协程和发包协程,只用于测试发包缓存,收包队列等内部逻辑,
+// 和收发包协程配合的测试在example里,使用真实的监听和连接
+func newTestConnection(config *ConnectionConfig, codec Codec, handler ConnectionHandler) *TcpConnection {
+	if codec == nil {
+		codec = NewDefaultCodec()
+	}
+	connection := NewTcpConnector(config, codec, handler)
+	connection.state = int32(ConnectionStateConnected)
+	return connection
+}
@@ -9,4 +9,22 @@ var (
 	// 数据包长度超出设置
 	ErrPacketLengthExceed = errors.New("packet length exceed")
 	ErrReadRemainPacket = errors.New("read remain packet data error")
+	// 序列号重复或乱序
+	ErrPacketSequenceReplay = errors.New("packet sequence replay")
+	// 序列号跳号
+	ErrPacketSequenceSkip = errors.New("packet sequence skip")
+	// HMAC校验失败
+	ErrPacketHmac = errors.New("packet hmac error")
+	// 包头里的序列号(PacketHeaderFieldSequence)不连续
+	ErrPacketHeaderSequence = errors.New("packet header sequence error")
+	// 该连接不支持数据包序列号
+	ErrSequenceNotSupport = errors.New("packet sequence not support")
+	// 消息不满足字段约束
+	ErrMessageConstraint = errors.New("message constraint error")
+	// 连接已关闭
+	ErrConnectionClosed = errors.New("connection closed")
+	// 发包缓存满而被丢弃
+	ErrSendOverflow = errors.New("send overflow")
+	// 收包队列满而断开连接
+	ErrRecvOverflow = errors.New("recv overflow")
 )
@@ -0,0 +1,40 @@
+package example
+
+import (
+	"testing"
+
+	. "github.com/fish-tennis/gnet"
+	"github.com/fish-tennis/gnet/example/pb"
+)
+
+// 测试根据消息号枚举的命名规范自动注册消息
+func TestAutoRegisterCommands(t *testing.T) {
+	// 服务器收到的是请求消息
+	serverCodec := NewProtoCodec(nil)
+	serverHandler := NewDefaultConnectionHandler(serverCodec)
+	if mismatches := serverHandler.AutoRegisterCommands("test", "", "Req"); len(mismatches) > 0 {
+		t.Fatalf("mismatches:%v", mismatches)
+	}
+	if _, ok := serverCodec.MessageCreatorMap[PacketCommand(pb.CmdTest_Cmd_HeartBeat)]().(*pb.HeartBeatReq); !ok {
+		t.Fatal("Cmd_HeartBeat not HeartBeatReq")
+	}
+	if _, ok := serverCodec.MessageCreatorMap[PacketCommand(pb.CmdTest_Cmd_TestMessage)]().(*pb.TestMessage); !ok {
+		t.Fatal("Cmd_TestMessage not TestMessage")
+	}
+
+	// 客户端收到的是回复消息
+	clientCodec := NewProtoCodec(nil)
+	if mismatches := AutoRegisterCommands(clientCodec, "test", "", "Res"); len(mismatches) > 0 {
+		t.Fatalf("mismatches:%v", mismatches)
+	}
+	if _, ok := clientCodec.MessageCreatorMap[PacketCommand(pb.CmdTest_Cmd_HeartBeat)]().(*pb.HeartBeatRes); !ok {
+		t.Fatal("Cmd_HeartBeat not HeartBeatRes")
+	}
+
+	// 找不到Cmd_HeartBeat对应的消息
+	mismatches := AutoRegisterCommands(NewProtoCodec(nil), "test")
+	if len(mismatches) != 1 {
+		t.Fatalf("mismatches:%v", mismatches)
+	}
+	t.Logf("mismatch:%v", mismatches[0])
+}
@@ -0,0 +1,76 @@
+package example
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/fish-tennis/gnet"
+)
+
+// 测试TcpConnectionNoRing批量发送多个大包:数据包的顺序和内容都正确
+func TestNoRingBatchBigPackets(t *testing.T) {
+	SetLogLevel(InfoLevel)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	netMgr := GetNetMgr()
+	defer func() {
+		cancel()
+		netMgr.Shutdown(true)
+	}()
+	connectionConfig := ConnectionConfig{
+		SendPacketCacheCap: 16,
+		MaxPacketSize:      1024 * 1024 * 4,
+		WriteTimeout:       1,
+	}
+	listenAddress := "127.0.0.1:10002"
+	const packetCount = 8
+	// 每个数据包的大小和内容都不同,且都大于单次写入的大小
+	newPacketData := func(index int) []byte {
+		packetData := make([]byte, NoRingWriteChunkSize*2+index*1000)
+		for i := range packetData {
+			packetData[i] = byte(i*7 + index)
+		}
+		return packetData
+	}
+
+	var recvCount int32
+	var errorCount int32
+	recvDone := make(chan struct{})
+	serverHandler := &funcConnectionHandler{onRecvPacket: func(connection Connection, packet Packet) {
+		index := int(atomic.LoadInt32(&recvCount))
+		if int(packet.Command()) != index+1 || !bytes.Equal(packet.GetStreamData(), newPacketData(index)) {
+			atomic.AddInt32(&errorCount, 1)
+		}
+		if atomic.AddInt32(&recvCount, 1) == packetCount {
+			close(recvDone)
+		}
+	}}
+	if netMgr.NewListenerCustom(ctx, listenAddress, connectionConfig, &CodecNoRing{}, serverHandler, nil, func(conn net.Conn, config *ConnectionConfig, codec Codec, handler ConnectionHandler) Connection {
+		return NewTcpConnectionNoRingAccept(conn, config, codec, handler)
+	}) == nil {
+		t.Fatal("listen failed")
+	}
+
+	clientHandler := &funcConnectionHandler{}
+	connector := netMgr.NewConnectorCustom(ctx, listenAddress, &connectionConfig, &CodecNoRing{}, clientHandler, nil, func(config *ConnectionConfig, codec Codec, handler ConnectionHandler) Connection {
+		return NewTcpConnectionNoRing(config, codec, handler)
+	})
+	if connector == nil {
+		t.Fatal("connect failed")
+	}
+	// 连续发送,发包协程会把多个数据包合并成一批发送
+	for i := 0; i < packetCount; i++ {
+		connector.SendPacket(NewBigDataPacket(uint16(i+1), newPacketData(i)))
+	}
+	select {
+	case <-recvDone:
+	case <-ctx.Done():
+		t.Fatalf("recvCount:%v", atomic.LoadInt32(&recvCount))
+	}
+	if atomic.LoadInt32(&errorCount) != 0 {
+		t.Fatalf("errorCount:%v", atomic.LoadInt32(&errorCount))
+	}
+}
@@ -96,8 +96,8 @@ func (e *echoBigPacketServerHandler) OnConnected(connection Connection, success
 	}
 }
 
-func (e *echoBigPacketServerHandler) OnDisconnected(connection Connection ) {
-	logger.Debug(fmt.Sprintf("Server OnDisconnected %v", connection.GetConnectionId()))
+func (e *echoBigPacketServerHandler) OnDisconnected(connection Connection, reason *CloseReason) {
+	logger.Debug(fmt.Sprintf("Server OnDisconnected %v reason:%v", connection.GetConnectionId(), reason))
 }
 
 func (e *echoBigPacketServerHandler) OnRecvPacket(connection Connection, packet Packet) {
@@ -120,8 +120,8 @@ func (e *echoBigPacketClientHandler) OnConnected(connection Connection, success
 	logger.Debug(fmt.Sprintf("Client OnConnected %v %v", connection.GetConnectionId(), success))
 }
 
-func (e *echoBigPacketClientHandler) OnDisconnected(connection Connection ) {
-	logger.Debug(fmt.Sprintf("Client OnDisconnected %v", connection.GetConnectionId()))
+func (e *echoBigPacketClientHandler) OnDisconnected(connection Connection, reason *CloseReason) {
+	logger.Debug(fmt.Sprintf("Client OnDisconnected %v reason:%v", connection.GetConnectionId(), reason))
 }
 
 func (e *echoBigPacketClientHandler) OnRecvPacket(connection Connection, packet Packet) {
@@ -0,0 +1,102 @@
+package example
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/fish-tennis/gnet"
+	"github.com/fish-tennis/gnet/example/pb"
+)
+
+// 测试优雅关闭:服务器踢掉客户端之前,踢人通知要能发送给客户端
+func TestCloseGracefully(t *testing.T) {
+	SetLogLevel(InfoLevel)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	netMgr := GetNetMgr()
+	defer func() {
+		cancel()
+		netMgr.Shutdown(true)
+	}()
+	connectionConfig := ConnectionConfig{
+		SendPacketCacheCap: 16,
+		SendBufferSize:     64,
+		RecvBufferSize:     64,
+		MaxPacketSize:      60,
+	}
+	listenAddress := "127.0.0.1:10002"
+	cmd := PacketCommand(pb.CmdTest_Cmd_TestMessage)
+
+	serverCodec := NewProtoCodec(nil)
+	serverHandler := NewDefaultConnectionHandler(serverCodec)
+	var serverDisconnected int32
+	serverHandler.SetOnDisconnectedFunc(func(connection Connection, reason *CloseReason) {
+		if reason.Code == CloseCodeGraceful {
+			atomic.StoreInt32(&serverDisconnected, 1)
+		} else {
+			atomic.StoreInt32(&serverDisconnected, 2)
+		}
+	})
+	var sendAfterKick int32 = 1
+	Register(serverHandler, cmd, func(connection Connection, message *pb.TestMessage) {
+		// 先发一些普通的数据包,再踢人
+		for i := 0; i < 10; i++ {
+			connection.Send(cmd, &pb.TestMessage{Name: "normal"})
+		}
+		Kick(connection, cmd, &pb.TestMessage{Name: "kick"}, time.Second*3)
+		if !connection.Send(cmd, &pb.TestMessage{Name: "after kick"}) {
+			atomic.StoreInt32(&sendAfterKick, 0)
+		}
+	})
+	if netMgr.NewListener(ctx, listenAddress, connectionConfig, serverCodec, serverHandler, nil) == nil {
+		t.Fatal("listen failed")
+	}
+
+	clientCodec := NewProtoCodec(nil)
+	clientHandler := NewDefaultConnectionHandler(clientCodec)
+	var recvNames []string
+	clientClosed := make(chan struct{})
+	var clientCloseReason *CloseReason
+	clientHandler.SetOnDisconnectedFunc(func(connection Connection, reason *CloseReason) {
+		clientCloseReason = reason
+		close(clientClosed)
+	})
+	Register(clientHandler, cmd, func(connection Connection, message *pb.TestMessage) {
+		recvNames = append(recvNames, message.Name)
+	})
+	connector := netMgr.NewConnector(ctx, listenAddress, &connectionConfig, clientCodec, clientHandler, nil)
+	if connector == nil {
+		t.Fatal("connect failed")
+	}
+	connector.Send(cmd, &pb.TestMessage{Name: "hello"})
+	select {
+	case <-clientClosed:
+	case <-ctx.Done():
+		t.Fatal("client not closed")
+	}
+	// 踢人通知是高优先级的,可能比前面的普通数据包先发送
+	kickCount := 0
+	for _, name := range recvNames {
+		if name == "kick" {
+			kickCount++
+		}
+	}
+	if len(recvNames) != 11 || kickCount != 1 {
+		t.Fatalf("recvNames:%v", recvNames)
+	}
+	// 客户端是被动关闭的
+	if clientCloseReason == nil || clientCloseReason.Code != CloseCodePeerEOF || connector.GetCloseReason() != clientCloseReason {
+		t.Fatalf("clientCloseReason:%v", clientCloseReason)
+	}
+	if atomic.LoadInt32(&sendAfterKick) != 0 {
+		t.Fatal("send after kick")
+	}
+	for atomic.LoadInt32(&serverDisconnected) == 0 && ctx.Err() == nil {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if atomic.LoadInt32(&serverDisconnected) != 1 {
+		t.Fatalf("server not closed gracefully:%v", serverDisconnected)
+	}
+}
+
@@ -0,0 +1,53 @@
+package example
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/fish-tennis/gnet"
+)
+
+// 测试收包协程panic的值不是error时,仍然记录关闭原因
+func TestReadLoopPanicCloseReason(t *testing.T) {
+	SetLogLevel(InfoLevel)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	netMgr := GetNetMgr()
+	defer func() {
+		cancel()
+		netMgr.Shutdown(true)
+	}()
+	connectionConfig := ConnectionConfig{
+		SendPacketCacheCap: 16,
+		SendBufferSize:     1024,
+		RecvBufferSize:     1024,
+		MaxPacketSize:      1024,
+	}
+	listenAddress := "127.0.0.1:10002"
+	closeReasons := make(chan *CloseReason, 1)
+	serverHandler := &funcConnectionHandler{
+		onRecvPacket: func(connection Connection, packet Packet) {
+			panic("not an error")
+		},
+		onDisconnected: func(connection Connection, reason *CloseReason) {
+			closeReasons <- reason
+		},
+	}
+	if netMgr.NewListener(ctx, listenAddress, connectionConfig, NewDefaultCodec(), serverHandler, nil) == nil {
+		t.Fatal("listen failed")
+	}
+	connector := netMgr.NewConnector(ctx, listenAddress, &connectionConfig, NewDefaultCodec(), &funcConnectionHandler{}, nil)
+	if connector == nil {
+		t.Fatal("connect failed")
+	}
+	connector.SendPacket(NewDataPacket([]byte("panic")))
+	select {
+	case reason := <-closeReasons:
+		if reason.Code != CloseCodeReadError || reason.Err == nil || !strings.Contains(reason.Err.Error(), "not an error") {
+			t.Fatalf("reason:%v", reason)
+		}
+	case <-ctx.Done():
+		t.Fatal("server connection not closed")
+	}
+}
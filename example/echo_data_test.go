@@ -56,8 +56,8 @@ func (e *echoListenerHandler) OnConnectionConnected(listener Listener, connectio
 	logger.Debug(fmt.Sprintf("OnConnectionConnected %v", connection.GetConnectionId()))
 }
 
-func (e *echoListenerHandler) OnConnectionDisconnect(listener Listener, connection Connection) {
-	logger.Debug(fmt.Sprintf("OnConnectionDisconnect %v", connection.GetConnectionId()))
+func (e *echoListenerHandler) OnConnectionDisconnect(listener Listener, connection Connection, reason *CloseReason) {
+	logger.Debug(fmt.Sprintf("OnConnectionDisconnect %v reason:%v", connection.GetConnectionId(), reason))
 }
 
 // 服务端监听到的连接接口
@@ -90,8 +90,8 @@ func (e *echoServerHandler) OnConnected(connection Connection, success bool) {
 	}
 }
 
-func (e *echoServerHandler) OnDisconnected(connection Connection ) {
-	logger.Debug(fmt.Sprintf("Server OnDisconnected %v", connection.GetConnectionId()))
+func (e *echoServerHandler) OnDisconnected(connection Connection, reason *CloseReason) {
+	logger.Debug(fmt.Sprintf("Server OnDisconnected %v reason:%v", connection.GetConnectionId(), reason))
 }
 
 func (e *echoServerHandler) OnRecvPacket(connection Connection, packet Packet) {
@@ -110,8 +110,8 @@ func (e *echoClientHandler) OnConnected(connection Connection, success bool) {
 	logger.Debug(fmt.Sprintf("Client OnConnected %v %v", connection.GetConnectionId(), success))
 }
 
-func (e *echoClientHandler) OnDisconnected(connection Connection ) {
-	logger.Debug(fmt.Sprintf("Client OnDisconnected %v", connection.GetConnectionId()))
+func (e *echoClientHandler) OnDisconnected(connection Connection, reason *CloseReason) {
+	logger.Debug(fmt.Sprintf("Client OnDisconnected %v reason:%v", connection.GetConnectionId(), reason))
 }
 
 func (e *echoClientHandler) OnRecvPacket(connection Connection, packet Packet) {
@@ -0,0 +1,32 @@
+package example
+
+import (
+	. "github.com/fish-tennis/gnet"
+)
+
+// 回调函数可选的ConnectionHandler,用于只关心部分回调的测试
+type funcConnectionHandler struct {
+	onConnected    func(connection Connection, success bool)
+	onDisconnected func(connection Connection, reason *CloseReason)
+	onRecvPacket   func(connection Connection, packet Packet)
+}
+
+func (this *funcConnectionHandler) OnConnected(connection Connection, success bool) {
+	if this.onConnected != nil {
+		this.onConnected(connection, success)
+	}
+}
+
+func (this *funcConnectionHandler) OnDisconnected(connection Connection, reason *CloseReason) {
+	if this.onDisconnected != nil {
+		this.onDisconnected(connection, reason)
+	}
+}
+
+func (this *funcConnectionHandler) OnRecvPacket(connection Connection, packet Packet) {
+	if this.onRecvPacket != nil {
+		this.onRecvPacket(connection, packet)
+	}
+}
+
+func (this *funcConnectionHandler) CreateHeartBeatPacket(connection Connection) Packet { return nil }
@@ -0,0 +1,178 @@
+package example
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/fish-tennis/gnet"
+	"github.com/fish-tennis/gnet/example/pb"
+)
+
+// 测试收包队列:handler处理慢时,收包队列达到高水位后暂停读取,数据包按顺序全部投递
+func TestInboundQueue(t *testing.T) {
+	SetLogLevel(InfoLevel)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	netMgr := GetNetMgr()
+	defer func() {
+		cancel()
+		netMgr.Shutdown(true)
+	}()
+	connectionConfig := ConnectionConfig{
+		SendPacketCacheCap: 32,
+		SendBufferSize:     64,
+		RecvBufferSize:     64,
+		MaxPacketSize:      60,
+	}
+	serverConnectionConfig := connectionConfig
+	serverConnectionConfig.InboundQueue = &InboundQueueConfig{
+		Capacity:      8,
+		HighWaterMark: 4,
+		LowWaterMark:  1,
+	}
+	listenAddress := "127.0.0.1:10002"
+	cmd := PacketCommand(pb.CmdTest_Cmd_TestMessage)
+	const sendCount = 20
+
+	serverCodec := NewProtoCodec(nil)
+	serverHandler := NewDefaultConnectionHandler(serverCodec)
+	var recvCount int32
+	var outOfOrder int32
+	serverConnectionChan := make(chan Connection, 1)
+	Register(serverHandler, cmd, func(connection Connection, message *pb.TestMessage) {
+		if message.I32 != atomic.LoadInt32(&recvCount) {
+			atomic.StoreInt32(&outOfOrder, 1)
+		}
+		// 模拟处理慢
+		time.Sleep(time.Millisecond * 10)
+		if atomic.AddInt32(&recvCount, 1) == sendCount {
+			serverConnectionChan <- connection
+		}
+	})
+	if netMgr.NewListener(ctx, listenAddress, serverConnectionConfig, serverCodec, serverHandler, nil) == nil {
+		t.Fatal("listen failed")
+	}
+
+	clientCodec := NewProtoCodec(nil)
+	clientHandler := NewDefaultConnectionHandler(clientCodec)
+	connector := netMgr.NewConnector(ctx, listenAddress, &connectionConfig, clientCodec, clientHandler, nil)
+	if connector == nil {
+		t.Fatal("connect failed")
+	}
+	for i := 0; i < sendCount; i++ {
+		connector.Send(cmd, &pb.TestMessage{Name: "hello", I32: int32(i)})
+	}
+	var serverConnection Connection
+	select {
+	case serverConnection = <-serverConnectionChan:
+	case <-ctx.Done():
+		t.Fatalf("recvCount:%v", atomic.LoadInt32(&recvCount))
+	}
+	if atomic.LoadInt32(&outOfOrder) != 0 {
+		t.Fatal("out of order")
+	}
+	stats := serverConnection.GetInboundQueueStats()
+	if stats.Enqueued != sendCount || stats.Dropped != 0 || stats.MaxDepth > 4 || stats.Capacity != 8 {
+		t.Fatalf("stats:%+v", stats)
+	}
+}
+
+// 测试对方正常关闭连接时:Dispatcher阻塞也不影响连接关闭,收包队列里剩余的数据包仍然会投递
+func TestInboundQueueDrainOnPeerClose(t *testing.T) {
+	testInboundQueueDrain(t, false)
+}
+
+// 服务器先调用CloseGracefully,记录的关闭原因是Graceful,对方关闭连接之前发送的数据包也继续投递
+func TestInboundQueueDrainOnLocalGraceful(t *testing.T) {
+	testInboundQueueDrain(t, true)
+}
+
+func testInboundQueueDrain(t *testing.T, serverGraceful bool) {
+	SetLogLevel(InfoLevel)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	netMgr := GetNetMgr()
+	defer func() {
+		cancel()
+		netMgr.Shutdown(true)
+	}()
+	connectionConfig := ConnectionConfig{
+		SendPacketCacheCap: 16,
+		SendBufferSize:     1024,
+		RecvBufferSize:     1024,
+		MaxPacketSize:      1024,
+	}
+	const sendCount = 5
+	var deliveredCount int32
+	blockDispatcher := make(chan struct{})
+	allDelivered := make(chan struct{})
+	serverConnectionConfig := connectionConfig
+	serverConnectionConfig.InboundQueue = &InboundQueueConfig{
+		Capacity: 8,
+		Dispatcher: func(connection Connection, packet Packet) {
+			<-blockDispatcher
+			if int(packet.GetStreamData()[0]) != int(atomic.LoadInt32(&deliveredCount)) {
+				t.Errorf("out of order:%v", packet.GetStreamData()[0])
+			}
+			if atomic.AddInt32(&deliveredCount, 1) == sendCount {
+				close(allDelivered)
+			}
+		},
+	}
+	listenAddress := "127.0.0.1:10002"
+	closeReasons := make(chan *CloseReason, 1)
+	serverConnections := make(chan Connection, 1)
+	serverHandler := &funcConnectionHandler{
+		onConnected: func(connection Connection, success bool) {
+			serverConnections <- connection
+		},
+		onDisconnected: func(connection Connection, reason *CloseReason) {
+			closeReasons <- reason
+		},
+	}
+	if netMgr.NewListener(ctx, listenAddress, serverConnectionConfig, NewDefaultCodec(), serverHandler, nil) == nil {
+		t.Fatal("listen failed")
+	}
+	connector := netMgr.NewConnector(ctx, listenAddress, &connectionConfig, NewDefaultCodec(), &funcConnectionHandler{}, nil)
+	if connector == nil {
+		t.Fatal("connect failed")
+	}
+	for i := 0; i < sendCount; i++ {
+		connector.SendPacket(NewDataPacket([]byte{byte(i)}))
+	}
+	if err := connector.Flush(ctx); err != nil {
+		t.Fatalf("flush err:%v", err)
+	}
+	expectCloseCode := CloseCodePeerEOF
+	if serverGraceful {
+		// 客户端收到EOF后关闭连接,服务器的收包协程读取到EOF
+		expectCloseCode = CloseCodeGraceful
+		select {
+		case serverConnection := <-serverConnections:
+			serverConnection.CloseGracefully(time.Second * 5)
+		case <-ctx.Done():
+			t.Fatal("server connection not connected")
+		}
+	} else {
+		connector.CloseGracefully(time.Second)
+	}
+	// Dispatcher还阻塞着,服务器的连接也能关闭
+	select {
+	case reason := <-closeReasons:
+		if reason.Code != expectCloseCode {
+			t.Fatalf("reason:%v", reason)
+		}
+	case <-ctx.Done():
+		t.Fatal("server connection not closed")
+	}
+	if atomic.LoadInt32(&deliveredCount) != 0 {
+		t.Fatalf("deliveredCount:%v", atomic.LoadInt32(&deliveredCount))
+	}
+	// 连接关闭后,剩余的数据包继续投递
+	close(blockDispatcher)
+	select {
+	case <-allDelivered:
+	case <-ctx.Done():
+		t.Fatalf("deliveredCount:%v", atomic.LoadInt32(&deliveredCount))
+	}
+}
@@ -0,0 +1,84 @@
+// Code generated by protoc-gen-gnet. DO NOT EDIT.
+// source: test.proto
+
+package pb
+
+import (
+	gnet "github.com/fish-tennis/gnet"
+	proto "google.golang.org/protobuf/proto"
+)
+
+// CmdTest服务器端的消息回调,收到的是Xxx或XxxReq消息
+type CmdTestServerHandler interface {
+	OnHeartBeatReq(connection gnet.Connection, message *HeartBeatReq)
+	OnTestMessage(connection gnet.Connection, message *TestMessage)
+}
+
+// 注册CmdTest的消息号和消息构造函数(Server)
+func RegisterCmdTestServerMessages(protoRegister gnet.ProtoRegister) {
+	protoRegister.Register(gnet.PacketCommand(CmdTest_Cmd_HeartBeat), func() proto.Message {
+		return new(HeartBeatReq)
+	})
+	protoRegister.Register(gnet.PacketCommand(CmdTest_Cmd_TestMessage), func() proto.Message {
+		return new(TestMessage)
+	})
+}
+
+// 注册CmdTestServerHandler的所有消息回调和消息构造函数
+func RegisterCmdTestServerHandler(register gnet.PacketHandlerRegister, handler CmdTestServerHandler) {
+	register.Register(gnet.PacketCommand(CmdTest_Cmd_HeartBeat), func(connection gnet.Connection, packet *gnet.ProtoPacket) {
+		handler.OnHeartBeatReq(connection, packet.Message().(*HeartBeatReq))
+	}, func() proto.Message {
+		return new(HeartBeatReq)
+	})
+	register.Register(gnet.PacketCommand(CmdTest_Cmd_TestMessage), func(connection gnet.Connection, packet *gnet.ProtoPacket) {
+		handler.OnTestMessage(connection, packet.Message().(*TestMessage))
+	}, func() proto.Message {
+		return new(TestMessage)
+	})
+}
+
+// CmdTest客户端的消息回调,收到的是Xxx或XxxRes消息
+type CmdTestClientHandler interface {
+	OnHeartBeatRes(connection gnet.Connection, message *HeartBeatRes)
+	OnTestMessage(connection gnet.Connection, message *TestMessage)
+}
+
+// 注册CmdTest的消息号和消息构造函数(Client)
+func RegisterCmdTestClientMessages(protoRegister gnet.ProtoRegister) {
+	protoRegister.Register(gnet.PacketCommand(CmdTest_Cmd_HeartBeat), func() proto.Message {
+		return new(HeartBeatRes)
+	})
+	protoRegister.Register(gnet.PacketCommand(CmdTest_Cmd_TestMessage), func() proto.Message {
+		return new(TestMessage)
+	})
+}
+
+// 注册CmdTestClientHandler的所有消息回调和消息构造函数
+func RegisterCmdTestClientHandler(register gnet.PacketHandlerRegister, handler CmdTestClientHandler) {
+	register.Register(gnet.PacketCommand(CmdTest_Cmd_HeartBeat), func(connection gnet.Connection, packet *gnet.ProtoPacket) {
+		handler.OnHeartBeatRes(connection, packet.Message().(*HeartBeatRes))
+	}, func() proto.Message {
+		return new(HeartBeatRes)
+	})
+	register.Register(gnet.PacketCommand(CmdTest_Cmd_TestMessage), func(connection gnet.Connection, packet *gnet.ProtoPacket) {
+		handler.OnTestMessage(connection, packet.Message().(*TestMessage))
+	}, func() proto.Message {
+		return new(TestMessage)
+	})
+}
+
+// 发送HeartBeatReq消息,消息号CmdTest_Cmd_HeartBeat
+func SendHeartBeatReq(connection gnet.Connection, message *HeartBeatReq) bool {
+	return connection.Send(gnet.PacketCommand(CmdTest_Cmd_HeartBeat), message)
+}
+
+// 发送TestMessage消息,消息号CmdTest_Cmd_TestMessage
+func SendTestMessage(connection gnet.Connection, message *TestMessage) bool {
+	return connection.Send(gnet.PacketCommand(CmdTest_Cmd_TestMessage), message)
+}
+
+// 发送HeartBeatRes消息,消息号CmdTest_Cmd_HeartBeat
+func SendHeartBeatRes(connection gnet.Connection, message *HeartBeatRes) bool {
+	return connection.Send(gnet.PacketCommand(CmdTest_Cmd_HeartBeat), message)
+}
@@ -0,0 +1,75 @@
+package example
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/fish-tennis/gnet"
+	"github.com/fish-tennis/gnet/example/pb"
+)
+
+// 测试暂停读取和恢复读取
+func TestPauseRead(t *testing.T) {
+	SetLogLevel(InfoLevel)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	netMgr := GetNetMgr()
+	defer func() {
+		cancel()
+		netMgr.Shutdown(true)
+	}()
+	connectionConfig := ConnectionConfig{
+		SendPacketCacheCap: 16,
+		SendBufferSize:     64,
+		RecvBufferSize:     64,
+		MaxPacketSize:      60,
+	}
+	listenAddress := "127.0.0.1:10002"
+	cmd := PacketCommand(pb.CmdTest_Cmd_TestMessage)
+
+	serverCodec := NewProtoCodec(nil)
+	serverHandler := NewDefaultConnectionHandler(serverCodec)
+	serverConnectionChan := make(chan Connection, 1)
+	serverHandler.SetOnConnectedFunc(func(connection Connection, success bool) {
+		if success {
+			// 连接一建立就暂停读取
+			connection.PauseRead()
+			serverConnectionChan <- connection
+		}
+	})
+	var recvCount int32
+	Register(serverHandler, cmd, func(connection Connection, message *pb.TestMessage) {
+		atomic.AddInt32(&recvCount, 1)
+	})
+	if netMgr.NewListener(ctx, listenAddress, connectionConfig, serverCodec, serverHandler, nil) == nil {
+		t.Fatal("listen failed")
+	}
+
+	clientCodec := NewProtoCodec(nil)
+	clientHandler := NewDefaultConnectionHandler(clientCodec)
+	connector := netMgr.NewConnector(ctx, listenAddress, &connectionConfig, clientCodec, clientHandler, nil)
+	if connector == nil {
+		t.Fatal("connect failed")
+	}
+	for i := 0; i < 5; i++ {
+		connector.Send(cmd, &pb.TestMessage{Name: "hello"})
+	}
+	var serverConnection Connection
+	select {
+	case serverConnection = <-serverConnectionChan:
+	case <-ctx.Done():
+		t.Fatal("server not connected")
+	}
+	time.Sleep(time.Millisecond * 500)
+	if atomic.LoadInt32(&recvCount) != 0 || !serverConnection.IsReadPaused() {
+		t.Fatalf("recv while paused:%v", atomic.LoadInt32(&recvCount))
+	}
+	serverConnection.ResumeRead()
+	for atomic.LoadInt32(&recvCount) < 5 && ctx.Err() == nil {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if atomic.LoadInt32(&recvCount) != 5 {
+		t.Fatalf("recvCount:%v", atomic.LoadInt32(&recvCount))
+	}
+}
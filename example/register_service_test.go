@@ -0,0 +1,62 @@
+package example
+
+import (
+	"testing"
+
+	. "github.com/fish-tennis/gnet"
+	"github.com/fish-tennis/gnet/example/pb"
+)
+
+type testService struct {
+	heartBeatCount   int
+	testMessageCount int
+}
+
+// 绑定Cmd_HeartBeat
+func (s *testService) OnHeartBeatReq(connection Connection, req *pb.HeartBeatReq) {
+	s.heartBeatCount++
+}
+
+// 绑定Cmd_TestMessage
+func (s *testService) OnTestMessage(connection Connection, req *pb.TestMessage) {
+	s.testMessageCount++
+}
+
+// 参数格式不符合,会被忽略
+func (s *testService) OnConnected(connection Connection, success bool) {
+}
+
+type testBadService struct {
+}
+
+// 没有对应的消息号
+func (s *testBadService) OnGoTestField(connection Connection, req *pb.GoTestField) {
+}
+
+// 测试注册一个对象的所有消息回调方法
+func TestRegisterService(t *testing.T) {
+	codec := NewProtoCodec(nil)
+	handler := NewDefaultConnectionHandler(codec)
+	service := &testService{}
+	if err := handler.RegisterService(service); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := codec.MessageCreatorMap[PacketCommand(pb.CmdTest_Cmd_HeartBeat)]().(*pb.HeartBeatReq); !ok {
+		t.Fatal("creator error")
+	}
+	handler.OnRecvPacket(nil, NewProtoPacket(PacketCommand(pb.CmdTest_Cmd_HeartBeat), &pb.HeartBeatReq{}))
+	handler.OnRecvPacket(nil, NewProtoPacket(PacketCommand(pb.CmdTest_Cmd_TestMessage), &pb.TestMessage{}))
+	if service.heartBeatCount != 1 || service.testMessageCount != 1 {
+		t.Fatalf("service:%v", service)
+	}
+	// 重复注册
+	if err := handler.RegisterService(&testService{}); err == nil {
+		t.Fatal("duplicate register")
+	}
+
+	err := NewDefaultConnectionHandler(NewProtoCodec(nil)).RegisterService(&testBadService{})
+	if err == nil {
+		t.Fatal("no command")
+	}
+	t.Logf("%v", err)
+}
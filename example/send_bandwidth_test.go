@@ -0,0 +1,91 @@
+package example
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/fish-tennis/gnet"
+)
+
+// 测试发包限速:高优先级的数据包不受限速,不会排在大量受限速的数据后面
+func TestSendBandwidthBypass(t *testing.T) {
+	SetLogLevel(InfoLevel)
+	for _, noRing := range []bool{false, true} {
+		testSendBandwidthBypass(t, noRing)
+	}
+}
+
+func testSendBandwidthBypass(t *testing.T, noRing bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	netMgr := GetNetMgr()
+	defer func() {
+		cancel()
+		netMgr.Shutdown(true)
+	}()
+	connectionConfig := ConnectionConfig{
+		SendPacketCacheCap: 64,
+		SendBufferSize:     1024 * 64,
+		RecvBufferSize:     1024 * 64,
+		MaxPacketSize:      1024 * 64,
+		RecvTimeout:        0,
+		WriteTimeout:       1,
+	}
+	listenAddress := "127.0.0.1:10002"
+	recvBypass := make(chan time.Time, 1)
+	serverHandler := &funcConnectionHandler{onRecvPacket: func(connection Connection, packet Packet) {
+		if string(packet.GetStreamData()) == "bypass" {
+			recvBypass <- time.Now()
+		}
+	}}
+	var codec Codec = NewDefaultCodec()
+	var createListenerConnection func(conn net.Conn, config *ConnectionConfig, codec Codec, handler ConnectionHandler) Connection
+	var createConnector func(config *ConnectionConfig, codec Codec, handler ConnectionHandler) Connection
+	if noRing {
+		codec = &CodecNoRing{}
+		createListenerConnection = func(conn net.Conn, config *ConnectionConfig, codec Codec, handler ConnectionHandler) Connection {
+			return NewTcpConnectionNoRingAccept(conn, config, codec, handler)
+		}
+		createConnector = func(config *ConnectionConfig, codec Codec, handler ConnectionHandler) Connection {
+			return NewTcpConnectionNoRing(config, codec, handler)
+		}
+	} else {
+		createListenerConnection = func(conn net.Conn, config *ConnectionConfig, codec Codec, handler ConnectionHandler) Connection {
+			return NewTcpConnectionAccept(conn, config, codec, handler)
+		}
+		createConnector = func(config *ConnectionConfig, codec Codec, handler ConnectionHandler) Connection {
+			return NewTcpConnector(config, codec, handler)
+		}
+	}
+	if netMgr.NewListenerCustom(ctx, listenAddress, connectionConfig, codec, serverHandler, nil, createListenerConnection) == nil {
+		t.Fatal("listen failed")
+	}
+
+	// 客户端限速10KB/s,先发送100KB受限速的数据,全部发完需要10秒左右
+	clientConfig := connectionConfig
+	clientConfig.SendBandwidth = &SendBandwidthConfig{
+		BytesPerSecond: 1024 * 10,
+		BurstBytes:     1024,
+	}
+	connector := netMgr.NewConnectorCustom(ctx, listenAddress, &clientConfig, codec, &funcConnectionHandler{}, nil, createConnector)
+	if connector == nil {
+		t.Fatal("connect failed")
+	}
+	for i := 0; i < 50; i++ {
+		connector.SendPacketWithPriority(NewDataPacket(make([]byte, 1024*2)), SendPriorityLow)
+	}
+	time.Sleep(time.Millisecond * 100)
+	begin := time.Now()
+	connector.SendPacketWithPriority(NewDataPacket([]byte("bypass")), SendPriorityHigh)
+	select {
+	case recvTime := <-recvBypass:
+		// 最多排在一次写入的受限速数据后面
+		if cost := recvTime.Sub(begin); cost > time.Second {
+			t.Fatalf("noRing:%v bypass cost:%v", noRing, cost)
+		}
+		t.Logf("noRing:%v bypass cost:%v", noRing, recvTime.Sub(begin))
+	case <-ctx.Done():
+		t.Fatalf("noRing:%v bypass packet timeout", noRing)
+	}
+}
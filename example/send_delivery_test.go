@@ -0,0 +1,162 @@
+package example
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/fish-tennis/gnet"
+)
+
+// 测试发送结果回调和Flush
+func TestSendDelivery(t *testing.T) {
+	SetLogLevel(InfoLevel)
+	testSendDelivery(t, NewDefaultCodec(), nil, nil)
+	// 不使用RingBuffer的连接
+	testSendDelivery(t, &CodecNoRing{}, func(conn net.Conn, config *ConnectionConfig, codec Codec, handler ConnectionHandler) Connection {
+		return NewTcpConnectionNoRingAccept(conn, config, codec, handler)
+	}, func(config *ConnectionConfig, codec Codec, handler ConnectionHandler) Connection {
+		return NewTcpConnectionNoRing(config, codec, handler)
+	})
+}
+
+func testSendDelivery(t *testing.T, codec Codec, acceptConnectionCreator AcceptConnectionCreator, connectionCreator ConnectionCreator) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	netMgr := GetNetMgr()
+	defer func() {
+		cancel()
+		netMgr.Shutdown(true)
+	}()
+	connectionConfig := ConnectionConfig{
+		SendPacketCacheCap: 16,
+		SendBufferSize:     64, // 设置的比较小,一个批次写不完
+		RecvBufferSize:     64,
+		MaxPacketSize:      60,
+	}
+	listenAddress := "127.0.0.1:10002"
+	serverHandler := &deliveryServerHandler{}
+	if acceptConnectionCreator == nil {
+		acceptConnectionCreator = func(conn net.Conn, config *ConnectionConfig, codec Codec, handler ConnectionHandler) Connection {
+			return NewTcpConnectionAccept(conn, config, codec, handler)
+		}
+		connectionCreator = func(config *ConnectionConfig, codec Codec, handler ConnectionHandler) Connection {
+			return NewTcpConnector(config, codec, handler)
+		}
+	}
+	if netMgr.NewListenerCustom(ctx, listenAddress, connectionConfig, codec, serverHandler, nil, acceptConnectionCreator) == nil {
+		t.Fatal("listen failed")
+	}
+	connector := netMgr.NewConnectorCustom(ctx, listenAddress, &connectionConfig, codec, &deliveryServerHandler{}, nil, connectionCreator)
+	if connector == nil {
+		t.Fatal("connect failed")
+	}
+
+	const packetCount = 100
+	var deliveredCount int32
+	for i := 0; i < packetCount; i++ {
+		connector.SendPacketWithCallback(NewDataPacket([]byte("delivery test data")), SendPriority(i%int(SendPriorityCount)), func(err error) {
+			if err == nil {
+				atomic.AddInt32(&deliveredCount, 1)
+			}
+		})
+	}
+	if err := connector.Flush(ctx); err != nil {
+		t.Fatalf("Flush err:%v", err)
+	}
+	if atomic.LoadInt32(&deliveredCount) != packetCount {
+		t.Fatalf("deliveredCount:%v", deliveredCount)
+	}
+	// 数据都已经写入socket,等待对方收完
+	for atomic.LoadInt32(&serverHandler.recvCount) < packetCount && ctx.Err() == nil {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if atomic.LoadInt32(&serverHandler.recvCount) != packetCount {
+		t.Fatalf("recvCount:%v", serverHandler.recvCount)
+	}
+
+	// 连接关闭之后
+	connector.Close()
+	var closedErr error
+	connector.SendPacketWithCallback(NewDataPacket([]byte("closed")), SendPriorityNormal, func(err error) {
+		closedErr = err
+	})
+	if closedErr != ErrConnectionClosed || connector.Flush(ctx) != ErrConnectionClosed {
+		t.Fatalf("closedErr:%v", closedErr)
+	}
+}
+
+type deliveryServerHandler struct {
+	recvCount int32
+}
+
+func (this *deliveryServerHandler) OnConnected(connection Connection, success bool) {
+}
+
+func (this *deliveryServerHandler) OnDisconnected(connection Connection, reason *CloseReason) {
+}
+
+func (this *deliveryServerHandler) OnRecvPacket(connection Connection, packet Packet) {
+	atomic.AddInt32(&this.recvCount, 1)
+}
+
+func (this *deliveryServerHandler) CreateHeartBeatPacket(connection Connection) Packet {
+	return nil
+}
+
+// 测试Flush:发包协程已经结束时,Flush返回ErrConnectionClosed,不会一直阻塞
+func TestFlushAfterWriteLoopExit(t *testing.T) {
+	SetLogLevel(InfoLevel)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	netMgr := GetNetMgr()
+	defer func() {
+		cancel()
+		netMgr.Shutdown(true)
+	}()
+	connectionConfig := ConnectionConfig{
+		SendPacketCacheCap: 1,
+		SendBufferSize:     1024,
+		RecvBufferSize:     1024,
+		MaxPacketSize:      1024,
+		SendOverflowPolicy: SendOverflowDropNewest,
+	}
+	listenAddress := "127.0.0.1:10002"
+	serverConnected := make(chan Connection, 1)
+	serverHandler := &funcConnectionHandler{onConnected: func(connection Connection, success bool) {
+		serverConnected <- connection
+	}}
+	if netMgr.NewListener(ctx, listenAddress, connectionConfig, NewDefaultCodec(), serverHandler, nil) == nil {
+		t.Fatal("listen failed")
+	}
+	// 发包限速每秒1字节,发包协程一直在等待令牌
+	clientConfig := connectionConfig
+	clientConfig.SendBandwidth = &SendBandwidthConfig{BytesPerSecond: 1, BurstBytes: 1}
+	connector := netMgr.NewConnector(ctx, listenAddress, &clientConfig, NewDefaultCodec(), &funcConnectionHandler{}, nil)
+	if connector == nil {
+		t.Fatal("connect failed")
+	}
+	serverConnection := <-serverConnected
+	connector.SendPacket(NewDataPacket([]byte("stuck")))
+	time.Sleep(time.Millisecond * 100)
+	// 填满所有优先级的发包缓存
+	for priority := SendPriorityHigh; priority < SendPriorityCount; priority++ {
+		for connector.SendPacketWithPriority(NewDataPacket([]byte("full")), priority) {
+		}
+	}
+	flushResult := make(chan error, 1)
+	go func() {
+		flushResult <- connector.Flush(context.Background())
+	}()
+	time.Sleep(time.Millisecond * 100)
+	// 对方关闭连接,发包协程结束,清空发包缓存
+	serverConnection.Close()
+	select {
+	case err := <-flushResult:
+		if err != ErrConnectionClosed {
+			t.Fatalf("Flush err:%v", err)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("Flush still blocked after close")
+	}
+}
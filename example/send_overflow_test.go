@@ -0,0 +1,74 @@
+package example
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/fish-tennis/gnet"
+)
+
+// 测试SendOverflowBlock:发包缓存满时阻塞的Send,在连接关闭后返回false,不会一直阻塞
+func TestSendBlockAfterClose(t *testing.T) {
+	SetLogLevel(InfoLevel)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	netMgr := GetNetMgr()
+	defer func() {
+		cancel()
+		netMgr.Shutdown(true)
+	}()
+	connectionConfig := ConnectionConfig{
+		SendPacketCacheCap: 1,
+		SendBufferSize:     1024,
+		RecvBufferSize:     1024,
+		MaxPacketSize:      1024,
+		WriteTimeout:       1,
+	}
+	listenAddress := "127.0.0.1:10002"
+	serverConnected := make(chan Connection, 1)
+	serverHandler := &funcConnectionHandler{onConnected: func(connection Connection, success bool) {
+		serverConnected <- connection
+	}}
+	if netMgr.NewListener(ctx, listenAddress, connectionConfig, NewDefaultCodec(), serverHandler, nil) == nil {
+		t.Fatal("listen failed")
+	}
+
+	// 发包限速每秒1字节,发包协程一直在等待令牌,发包缓存很快就满了
+	clientConfig := connectionConfig
+	clientConfig.SendBandwidth = &SendBandwidthConfig{BytesPerSecond: 1, BurstBytes: 1}
+	connector := netMgr.NewConnector(ctx, listenAddress, &clientConfig, NewDefaultCodec(), &funcConnectionHandler{}, nil)
+	if connector == nil {
+		t.Fatal("connect failed")
+	}
+	serverConnection := <-serverConnected
+	// 多个协程同时阻塞在Send,连接关闭时发包协程清空发包缓存,也只能唤醒其中一部分
+	const senderCount = 4
+	sendResult := make(chan bool, senderCount)
+	for i := 0; i < senderCount; i++ {
+		go func() {
+			for {
+				if !connector.SendPacket(NewDataPacket([]byte("block"))) {
+					sendResult <- false
+					return
+				}
+			}
+		}()
+	}
+	// 等待Send阻塞
+	time.Sleep(time.Millisecond * 200)
+	if len(sendResult) > 0 {
+		t.Fatal("send not blocked")
+	}
+	// 对方关闭连接,阻塞的Send都返回false
+	serverConnection.Close()
+	for i := 0; i < senderCount; i++ {
+		select {
+		case <-sendResult:
+		case <-time.After(time.Second * 3):
+			t.Fatalf("%v send still blocked after close", senderCount-i)
+		}
+	}
+	if connector.IsConnected() {
+		t.Fatal("connector not closed")
+	}
+}
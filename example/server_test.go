@@ -94,8 +94,8 @@ func (e *testServerListenerHandler) OnConnectionConnected(listener Listener, con
 	logger.Debug(fmt.Sprintf("OnConnectionConnected %v", connection.GetConnectionId()))
 }
 
-func (e *testServerListenerHandler) OnConnectionDisconnect(listener Listener, connection Connection) {
-	logger.Debug(fmt.Sprintf("OnConnectionDisconnect %v", connection.GetConnectionId()))
+func (e *testServerListenerHandler) OnConnectionDisconnect(listener Listener, connection Connection, reason *CloseReason) {
+	logger.Debug(fmt.Sprintf("OnConnectionDisconnect %v reason:%v", connection.GetConnectionId(), reason))
 }
 
 // 服务器端的客户端接口
@@ -125,7 +125,7 @@ func (t *testServerClientHandler) OnConnected(connection Connection, success boo
 	connection.SendPacket(toPacket)
 }
 
-func (t *testServerClientHandler) OnDisconnected(connection Connection) {
+func (t *testServerClientHandler) OnDisconnected(connection Connection, reason *CloseReason) {
 }
 
 func (t *testServerClientHandler) OnRecvPacket(connection Connection, packet Packet) {
@@ -160,7 +160,7 @@ func (t *testClientHandler) CreateHeartBeatPacket(connection Connection) Packet
 func (t *testClientHandler) OnConnected(connection Connection, success bool) {
 }
 
-func (t *testClientHandler) OnDisconnected(connection Connection) {
+func (t *testClientHandler) OnDisconnected(connection Connection, reason *CloseReason) {
 }
 
 func (t *testClientHandler) OnRecvPacket(connection Connection, packet Packet) {
@@ -0,0 +1,34 @@
+package example
+
+import (
+	"testing"
+
+	. "github.com/fish-tennis/gnet"
+	"github.com/fish-tennis/gnet/example/pb"
+)
+
+// 测试带类型的消息回调注册
+func TestTypedHandler(t *testing.T) {
+	codec := NewProtoCodec(nil)
+	handler := NewDefaultConnectionHandler(codec)
+	var recvMessage *pb.TestMessage
+	Register(handler, PacketCommand(pb.CmdTest_Cmd_TestMessage), func(connection Connection, message *pb.TestMessage) {
+		recvMessage = message
+	})
+	// 消息构造函数由类型推导
+	if _, ok := codec.MessageCreatorMap[PacketCommand(pb.CmdTest_Cmd_TestMessage)]().(*pb.TestMessage); !ok {
+		t.Fatal("creator error")
+	}
+	handler.OnRecvPacket(nil, NewProtoPacket(PacketCommand(pb.CmdTest_Cmd_TestMessage), &pb.TestMessage{Name: "typed"}))
+	if recvMessage.GetName() != "typed" {
+		t.Fatalf("recvMessage:%v", recvMessage)
+	}
+
+	// 重复注册
+	defer func() {
+		if err := recover(); err == nil {
+			t.Fatal("duplicate register not panic")
+		}
+	}()
+	Register(handler, PacketCommand(pb.CmdTest_Cmd_TestMessage), func(connection Connection, message *pb.TestMessage) {})
+}
@@ -1,5 +1,5 @@
 module github.com/fish-tennis/gnet
 
-go 1.16
+go 1.18
 
 require google.golang.org/protobuf v1.26.0
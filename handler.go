@@ -1,12 +1,21 @@
 package gnet
 
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
 // 连接回调
 type ConnectionHandler interface {
 	// 连接成功或失败
 	OnConnected(connection Connection, success bool)
 
 	// 断开连接
-	OnDisconnected(connection Connection)
+	// reason:关闭原因
+	OnDisconnected(connection Connection, reason *CloseReason)
 
 	// 收到一个完整数据包
 	// 在收包协程中调用
@@ -24,7 +33,8 @@ type ListenerHandler interface {
 	OnConnectionConnected(listener Listener, acceptedConnection Connection)
 
 	// a connection disconnect
-	OnConnectionDisconnect(listener Listener, connection Connection)
+	// reason:关闭原因
+	OnConnectionDisconnect(listener Listener, connection Connection, reason *CloseReason)
 }
 
 type PacketHandlerRegister interface {
@@ -35,15 +45,31 @@ type PacketHandlerRegister interface {
 // ProtoPacket消息回调
 type PacketHandler func(connection Connection, packet* ProtoPacket)
 
+// ProtoPacket消息观察者
+// 返回false时,阻止后续的观察者和PacketHandler执行
+type PacketObserver func(connection Connection, packet *ProtoPacket) bool
+
+type packetObserver struct {
+	// 优先级,数值小的先执行
+	priority int
+	observer PacketObserver
+}
+
 // ProtoPacket默认ConnectionHandler
 type DefaultConnectionHandler struct {
 	// 注册消息的处理函数map
 	PacketHandlers map[PacketCommand]PacketHandler
+	// 同一个消息号的多个观察者,按优先级排序
+	packetObservers map[PacketCommand][]*packetObserver
+	// 是否允许同一个消息号多次Register
+	allowMultipleHandlers bool
 	// 未注册消息的处理函数
 	UnRegisterHandler PacketHandler
+	// 消息校验
+	validation packetValidation
 	// 连接回调
 	onConnectedFunc func(connection Connection, success bool)
-	onDisconnectedFunc func(connection Connection)
+	onDisconnectedFunc func(connection Connection, reason *CloseReason)
 	// handler一般总是和codec配合使用
 	protoCodec Codec
 	// 心跳包消息号(只对connector有效)
@@ -58,9 +84,9 @@ func (this *DefaultConnectionHandler) OnConnected(connection Connection, success
 	}
 }
 
-func (this *DefaultConnectionHandler) OnDisconnected(connection Connection) {
+func (this *DefaultConnectionHandler) OnDisconnected(connection Connection, reason *CloseReason) {
 	if this.onDisconnectedFunc != nil {
-		this.onDisconnectedFunc(connection)
+		this.onDisconnectedFunc(connection, reason)
 	}
 }
 
@@ -72,13 +98,33 @@ func (this *DefaultConnectionHandler) OnRecvPacket(connection Connection, packet
 		}
 	}()
 	if protoPacket,ok := packet.(*ProtoPacket); ok {
+		if err := this.validation.validate(connection, protoPacket); err != nil {
+			this.validation.reject(connection, protoPacket, err)
+			return
+		}
+		handled := false
+		observers := this.packetObservers[protoPacket.command]
+		i := 0
+		// 优先级<0的观察者在PacketHandler之前执行
+		for ; i < len(observers) && observers[i].priority < 0; i++ {
+			handled = true
+			if !observers[i].observer(connection, protoPacket) {
+				return
+			}
+		}
 		if packetHandler,ok2 := this.PacketHandlers[protoPacket.command]; ok2 {
 			if packetHandler != nil {
 				packetHandler(connection, protoPacket)
+				handled = true
+			}
+		}
+		for ; i < len(observers); i++ {
+			handled = true
+			if !observers[i].observer(connection, protoPacket) {
 				return
 			}
 		}
-		if this.UnRegisterHandler != nil {
+		if !handled && this.UnRegisterHandler != nil {
 			this.UnRegisterHandler(connection, protoPacket)
 		}
 	}
@@ -94,7 +140,11 @@ func (this *DefaultConnectionHandler) CreateHeartBeatPacket(connection Connectio
 func NewDefaultConnectionHandler(protoCodec Codec) *DefaultConnectionHandler {
 	return &DefaultConnectionHandler{
 		PacketHandlers: make(map[PacketCommand]PacketHandler),
+		packetObservers: make(map[PacketCommand][]*packetObserver),
 		protoCodec:     protoCodec,
+		validation: packetValidation{
+			validators: make(map[PacketCommand]PacketValidator),
+		},
 	}
 }
 
@@ -104,8 +154,21 @@ func (this *DefaultConnectionHandler) GetCodec() Codec {
 
 // 注册消息号和消息回调,消息构造的映射
 // handler在TcpConnection的read协程中被调用
+// 同一个消息号重复注册handler时会panic,应该在程序启动时注册
+// SetAllowMultipleHandlers(true)之后,重复注册的handler作为优先级为0的观察者,在第一个handler之后执行
+// handler没有返回值,不能阻止后续的观察者执行,需要阻止时使用AddPacketObserver
 func (this *DefaultConnectionHandler) Register(packetCommand PacketCommand, handler PacketHandler, creator ProtoMessageCreator) {
-	this.PacketHandlers[packetCommand] = handler
+	if handler != nil && this.HasPacketHandler(packetCommand) {
+		if !this.allowMultipleHandlers {
+			panic(fmt.Sprintf("duplicate register command:%v", packetCommand))
+		}
+		this.AddPacketObserver(packetCommand, 0, func(connection Connection, packet *ProtoPacket) bool {
+			handler(connection, packet)
+			return true
+		})
+	} else if handler != nil || !this.HasPacketHandler(packetCommand) {
+		this.PacketHandlers[packetCommand] = handler
+	}
 	if this.protoCodec != nil && creator != nil {
 		if protoRegister,ok := this.protoCodec.(ProtoRegister); ok {
 			protoRegister.Register(packetCommand, creator)
@@ -113,6 +176,41 @@ func (this *DefaultConnectionHandler) Register(packetCommand PacketCommand, hand
 	}
 }
 
+// 根据消息号枚举的命名规范(Cmd_MessageName),把指定package的所有消息注册到codec
+// 消息回调可以之后再用Register(packetCommand, handler, nil)注册
+func (this *DefaultConnectionHandler) AutoRegisterCommands(packageName protoreflect.FullName, messageSuffixes ...string) []error {
+	protoRegister,ok := this.protoCodec.(ProtoRegister)
+	if !ok {
+		return []error{ErrNotSupport}
+	}
+	return AutoRegisterCommands(protoRegister, packageName, messageSuffixes...)
+}
+
+// 注册消息观察者,同一个消息号可以注册多个观察者
+// priority:数值小的先执行,优先级<0的在Register注册的handler之前执行,其他的在之后执行,相同优先级按注册顺序执行
+// observer返回false时,阻止后续的观察者和handler执行
+// observer在TcpConnection的read协程中被调用
+func (this *DefaultConnectionHandler) AddPacketObserver(packetCommand PacketCommand, priority int, observer PacketObserver) {
+	observers := append(this.packetObservers[packetCommand], &packetObserver{
+		priority: priority,
+		observer: observer,
+	})
+	sort.SliceStable(observers, func(i, j int) bool {
+		return observers[i].priority < observers[j].priority
+	})
+	this.packetObservers[packetCommand] = observers
+}
+
+// 是否允许同一个消息号多次Register
+func (this *DefaultConnectionHandler) SetAllowMultipleHandlers(allowMultipleHandlers bool) {
+	this.allowMultipleHandlers = allowMultipleHandlers
+}
+
+// 是否已经注册了消息回调
+func (this *DefaultConnectionHandler) HasPacketHandler(packetCommand PacketCommand) bool {
+	return this.PacketHandlers[packetCommand] != nil
+}
+
 func (this *DefaultConnectionHandler) GetPacketHandler(packetCommand PacketCommand) PacketHandler {
 	return this.PacketHandlers[packetCommand]
 }
@@ -129,12 +227,57 @@ func (this *DefaultConnectionHandler) SetUnRegisterHandler(unRegisterHandler Pac
 	this.UnRegisterHandler = unRegisterHandler
 }
 
+// 注册消息号对应的校验函数
+// validator在消息解码之后,消息回调之前,在TcpConnection的read协程中被调用
+func (this *DefaultConnectionHandler) RegisterValidator(packetCommand PacketCommand, validator PacketValidator) {
+	this.validation.validators[packetCommand] = validator
+}
+
+// 设置proto字段约束,对所有消息生效
+func (this *DefaultConnectionHandler) SetMessageConstraints(constraints *MessageConstraints) {
+	this.validation.constraints = constraints
+}
+
+// 设置校验失败的回调,不设置时输出错误日志
+// onReject在TcpConnection的read协程中被调用
+func (this *DefaultConnectionHandler) SetOnPacketRejected(onReject PacketRejectHandler) {
+	this.validation.onReject = onReject
+}
+
+// 消息号校验失败的次数
+func (this *DefaultConnectionHandler) GetRejectCount(packetCommand PacketCommand) int64 {
+	return this.validation.getRejectCount(packetCommand)
+}
+
 // 设置连接回调
 func (this *DefaultConnectionHandler) SetOnConnectedFunc(onConnectedFunc func(connection Connection, success bool)) {
 	this.onConnectedFunc = onConnectedFunc
 }
 
 // 设置连接断开回调
-func (this *DefaultConnectionHandler) SetOnDisconnectedFunc(onDisconnectedFunc func(connection Connection)) {
+func (this *DefaultConnectionHandler) SetOnDisconnectedFunc(onDisconnectedFunc func(connection Connection, reason *CloseReason)) {
 	this.onDisconnectedFunc = onDisconnectedFunc
-}
\ No newline at end of file
+}
+
+// 注册消息号和带类型的消息回调,消息构造函数由T推导
+// 重复注册同一个消息号会panic,即使设置了SetAllowMultipleHandlers(true),应该在程序启动时注册
+//  Register(handler, PacketCommand(pb.CmdTest_Cmd_TestMessage), func(connection Connection, message *pb.TestMessage) {
+//    // do something
+//  })
+func Register[T proto.Message](handler *DefaultConnectionHandler, packetCommand PacketCommand, typedHandler func(connection Connection, message T)) {
+	if handler.HasPacketHandler(packetCommand) {
+		panic(fmt.Sprintf("duplicate register command:%v", packetCommand))
+	}
+	var zero T
+	messageType := zero.ProtoReflect().Type()
+	handler.Register(packetCommand, func(connection Connection, packet *ProtoPacket) {
+		message,ok := packet.Message().(T)
+		if !ok {
+			logger.Error("%v message type error cmd:%v", connection.GetConnectionId(), packetCommand)
+			return
+		}
+		typedHandler(connection, message)
+	}, func() proto.Message {
+		return messageType.New().Interface()
+	})
+}
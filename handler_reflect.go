@@ -0,0 +1,124 @@
+package gnet
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+var (
+	connectionType   = reflect.TypeOf((*Connection)(nil)).Elem()
+	protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+)
+
+// 消息回调方法名的前缀
+const HandlerMethodPrefix = "On"
+
+// 注册一个对象的所有消息回调方法
+// 方法格式: OnXxx(connection Connection, message *pb.Xxx)
+// 消息号: 和消息同一个package的消息号枚举值Cmd_Xxx,消息名带Req或Res后缀时,也可以匹配去掉后缀的Cmd_Xxx
+// 以On开头但参数格式不符合的方法会被忽略
+// 有方法找不到对应的消息号或者消息号重复时,返回error,并且不注册任何方法
+// NOTE:使用了反射,应该在程序启动时调用
+func (this *DefaultConnectionHandler) RegisterService(service interface{}) error {
+	serviceValue := reflect.ValueOf(service)
+	serviceType := serviceValue.Type()
+	type methodCommand struct {
+		method      reflect.Value
+		command     PacketCommand
+		messageType protoreflect.MessageType
+	}
+	var methodCommands []*methodCommand
+	var errs []string
+	registered := make(map[PacketCommand]string)
+	for i := 0; i < serviceType.NumMethod(); i++ {
+		method := serviceType.Method(i)
+		if !strings.HasPrefix(method.Name, HandlerMethodPrefix) {
+			continue
+		}
+		// 第一个参数是接收者
+		methodType := method.Type
+		if methodType.NumIn() != 3 || methodType.NumOut() != 0 || methodType.In(1) != connectionType ||
+			methodType.In(2).Kind() != reflect.Ptr || !methodType.In(2).Implements(protoMessageType) {
+			continue
+		}
+		messageType := reflect.Zero(methodType.In(2)).Interface().(proto.Message).ProtoReflect().Type()
+		messageDescriptor := messageType.Descriptor()
+		if method.Name != HandlerMethodPrefix+string(messageDescriptor.Name()) {
+			errs = append(errs, fmt.Sprintf("%v message name mismatch:%v", method.Name, messageDescriptor.FullName()))
+			continue
+		}
+		command, ok := FindCommandByMessage(messageDescriptor)
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%v no command for %v", method.Name, messageDescriptor.FullName()))
+			continue
+		}
+		if existMethod, ok := registered[command]; ok {
+			errs = append(errs, fmt.Sprintf("%v command %v duplicate with %v", method.Name, command, existMethod))
+			continue
+		}
+		if this.HasPacketHandler(command) {
+			errs = append(errs, fmt.Sprintf("%v command %v already registered", method.Name, command))
+			continue
+		}
+		registered[command] = method.Name
+		methodCommands = append(methodCommands, &methodCommand{
+			method:      serviceValue.Method(i),
+			command:     command,
+			messageType: messageType,
+		})
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("RegisterService %v: %v", serviceType, strings.Join(errs, "; "))
+	}
+	for _, m := range methodCommands {
+		method := m.method
+		messageType := m.messageType
+		this.Register(m.command, func(connection Connection, packet *ProtoPacket) {
+			if packet.Message() == nil || packet.Message().ProtoReflect().Type() != messageType {
+				logger.Error("%v message type error cmd:%v", connection.GetConnectionId(), packet.Command())
+				return
+			}
+			method.Call([]reflect.Value{reflect.ValueOf(&connection).Elem(), reflect.ValueOf(packet.Message())})
+		}, func() proto.Message {
+			return messageType.New().Interface()
+		})
+	}
+	return nil
+}
+
+// 在消息所在package的消息号枚举里,查找消息对应的消息号
+// 查找顺序: Cmd_MessageName,去掉Req或Res后缀的Cmd_MessageName
+func FindCommandByMessage(messageDescriptor protoreflect.MessageDescriptor) (PacketCommand, bool) {
+	messageName := string(messageDescriptor.Name())
+	valueNames := []string{CommandValuePrefix + messageName}
+	for _, suffix := range []string{"Req", "Res"} {
+		if strings.HasSuffix(messageName, suffix) {
+			valueNames = append(valueNames, CommandValuePrefix+strings.TrimSuffix(messageName, suffix))
+		}
+	}
+	packageName := messageDescriptor.ParentFile().Package()
+	for _, valueName := range valueNames {
+		valueFullName := packageName.Append(protoreflect.Name(valueName))
+		if packageName == "" {
+			valueFullName = protoreflect.FullName(valueName)
+		}
+		descriptor, err := protoregistry.GlobalFiles.FindDescriptorByName(valueFullName)
+		if err != nil {
+			continue
+		}
+		valueDescriptor, ok := descriptor.(protoreflect.EnumValueDescriptor)
+		if !ok || !strings.HasPrefix(string(valueDescriptor.Parent().Name()), CommandEnumPrefix) {
+			continue
+		}
+		if valueDescriptor.Number() <= 0 || valueDescriptor.Number() > 0xFFFF {
+			continue
+		}
+		return PacketCommand(valueDescriptor.Number()), true
+	}
+	return 0, false
+}
@@ -0,0 +1,118 @@
+package gnet
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestPacketObserver(t *testing.T) {
+	var calls []string
+	handler := NewDefaultConnectionHandler(NewProtoCodec(nil))
+	creator := func() proto.Message { return &wrapperspb.StringValue{} }
+	handler.Register(1, func(connection Connection, packet *ProtoPacket) {
+		calls = append(calls, "handler")
+	}, creator)
+	// 默认不允许重复注册
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("duplicate register")
+			}
+		}()
+		handler.Register(1, func(connection Connection, packet *ProtoPacket) {
+			calls = append(calls, "duplicate")
+		}, creator)
+	}()
+	handler.AddPacketObserver(1, 10, func(connection Connection, packet *ProtoPacket) bool {
+		calls = append(calls, "after")
+		return true
+	})
+	handler.AddPacketObserver(1, -1, func(connection Connection, packet *ProtoPacket) bool {
+		calls = append(calls, "before")
+		return true
+	})
+	handler.SetAllowMultipleHandlers(true)
+	handler.Register(1, func(connection Connection, packet *ProtoPacket) {
+		calls = append(calls, "second")
+	}, creator)
+	handler.OnRecvPacket(nil, NewProtoPacket(1, wrapperspb.String("")))
+	if len(calls) != 4 || calls[0] != "before" || calls[1] != "handler" || calls[2] != "second" || calls[3] != "after" {
+		t.Fatalf("calls:%v", calls)
+	}
+
+	// 阻止后续的执行
+	calls = calls[:0]
+	handler.AddPacketObserver(1, -2, func(connection Connection, packet *ProtoPacket) bool {
+		calls = append(calls, "stop")
+		return false
+	})
+	handler.OnRecvPacket(nil, NewProtoPacket(1, wrapperspb.String("")))
+	if len(calls) != 1 || calls[0] != "stop" {
+		t.Fatalf("calls:%v", calls)
+	}
+
+	// 只有观察者时,不会调用UnRegisterHandler
+	unregistered := 0
+	handler.UnRegisterHandler = func(connection Connection, packet *ProtoPacket) {
+		unregistered++
+	}
+	handler.AddPacketObserver(2, 0, func(connection Connection, packet *ProtoPacket) bool {
+		return true
+	})
+	handler.OnRecvPacket(nil, NewProtoPacket(2, nil))
+	handler.OnRecvPacket(nil, NewProtoPacket(3, nil))
+	if unregistered != 1 {
+		t.Fatalf("unregistered:%v", unregistered)
+	}
+}
+
+func TestPacketValidator(t *testing.T) {
+	handler := NewDefaultConnectionHandler(NewProtoCodec(nil))
+	recvCount := 0
+	handler.Register(1, func(connection Connection, packet *ProtoPacket) {
+		recvCount++
+	}, nil)
+	handler.Register(2, func(connection Connection, packet *ProtoPacket) {
+		recvCount++
+	}, nil)
+	handler.SetMessageConstraints(&MessageConstraints{MaxStringLength: 5})
+	handler.RegisterValidator(2, func(connection Connection, packet *ProtoPacket) error {
+		if packet.Message().(*wrapperspb.StringValue).GetValue() == "" {
+			return ErrNotSupport
+		}
+		return nil
+	})
+	var rejectErrs []error
+	handler.SetOnPacketRejected(func(connection Connection, packet *ProtoPacket, err error) {
+		rejectErrs = append(rejectErrs, err)
+	})
+	handler.OnRecvPacket(nil, NewProtoPacket(1, wrapperspb.String("hello")))
+	handler.OnRecvPacket(nil, NewProtoPacket(1, wrapperspb.String("hello world")))
+	handler.OnRecvPacket(nil, NewProtoPacket(2, wrapperspb.String("")))
+	handler.OnRecvPacket(nil, NewProtoPacket(2, wrapperspb.String("a")))
+	if recvCount != 2 || len(rejectErrs) != 2 {
+		t.Fatalf("recvCount:%v rejectErrs:%v", recvCount, rejectErrs)
+	}
+	if !errors.Is(rejectErrs[0], ErrMessageConstraint) || rejectErrs[1] != ErrNotSupport {
+		t.Fatalf("rejectErrs:%v", rejectErrs)
+	}
+	if handler.GetRejectCount(1) != 1 || handler.GetRejectCount(2) != 1 || handler.GetRejectCount(3) != 0 {
+		t.Fatalf("rejectCount:%v %v", handler.GetRejectCount(1), handler.GetRejectCount(2))
+	}
+}
+
+// 带类型的Register重复注册时总是panic
+func TestRegisterTypedDuplicate(t *testing.T) {
+	handler := NewDefaultConnectionHandler(NewProtoCodec(nil))
+	handler.SetAllowMultipleHandlers(true)
+	Register(handler, 1, func(connection Connection, message *wrapperspb.StringValue) {})
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicate register")
+		}
+	}()
+	Register(handler, 1, func(connection Connection, message *wrapperspb.StringValue) {})
+}
@@ -0,0 +1,274 @@
+package gnet
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// 收包队列的默认容量
+	DefaultInboundQueueCapacity = 256
+)
+
+// 收包队列满时的处理方式
+type InboundOverflowPolicy uint8
+
+const (
+	// 阻塞收包协程,直到收包队列有空位(默认)
+	InboundOverflowBlock InboundOverflowPolicy = iota
+	// 丢弃新的数据包
+	InboundOverflowDropNewest
+	// 丢弃收包队列里最早的数据包
+	InboundOverflowDropOldest
+	// 断开连接(处理太慢或者发包太快的连接)
+	InboundOverflowDisconnect
+)
+
+// 收包队列满时,丢弃数据包或断开连接的回调
+// packet:被丢弃的数据包,断开连接时是新的数据包
+type InboundOverflowHandler func(connection Connection, packet Packet, policy InboundOverflowPolicy)
+
+// 收包队列设置
+// 设置后,收包协程不再直接调用handler.OnRecvPacket,而是把数据包放入收包队列,
+// 由每个连接单独的投递协程按顺序投递,handler处理慢不会影响socket的读取
+// 对方正常关闭连接时,连接立即关闭(会先调用OnDisconnected),收包队列里剩余的数据包仍然会继续投递,
+// 其他原因关闭连接或者Start传入的ctx结束时,剩余的数据包被丢弃
+type InboundQueueConfig struct {
+	// 队列容量(数据包个数),为0时使用DefaultInboundQueueCapacity
+	Capacity uint32
+	// 高水位,队列长度达到高水位时暂停读取,为0时不暂停读取,队列满时按照OverflowPolicy处理
+	HighWaterMark uint32
+	// 低水位,暂停读取后,队列长度降到低水位及以下时恢复读取
+	LowWaterMark uint32
+	// 队列满时的处理方式
+	OverflowPolicy InboundOverflowPolicy
+	// 队列满时,丢弃数据包或断开连接的回调
+	OnOverflow InboundOverflowHandler
+	// 投递目标,为nil时投递给handler.OnRecvPacket
+	// 可以用来把数据包转发给逻辑协程的消息队列,Dispatcher阻塞时,收包队列会逐渐堆积,达到高水位后暂停读取
+	Dispatcher func(connection Connection, packet Packet)
+}
+
+// 收包队列统计
+type InboundQueueStats struct {
+	// 当前队列长度
+	Depth int
+	// 队列容量
+	Capacity int
+	// 队列长度的历史最大值
+	MaxDepth int
+	// 放入队列的数据包数量
+	Enqueued uint64
+	// 投递的数据包数量
+	Delivered uint64
+	// 因为队列满或连接关闭而丢弃的数据包数量
+	Dropped uint64
+}
+
+// 收包队列
+type inboundQueue struct {
+	// 64位原子操作的字段放在最前面,保证32位平台上的对齐
+	enqueuedCount  uint64
+	deliveredCount uint64
+	droppedCount   uint64
+	maxDepth       int32
+	config         *InboundQueueConfig
+	packets        chan Packet
+	// 对方正常关闭连接后,继续投递剩余的数据包
+	draining  int32
+	closeOnce sync.Once
+}
+
+func newInboundQueue(config *InboundQueueConfig) *inboundQueue {
+	if config == nil {
+		return nil
+	}
+	capacity := config.Capacity
+	if capacity == 0 {
+		capacity = DefaultInboundQueueCapacity
+	}
+	return &inboundQueue{
+		config:  config,
+		packets: make(chan Packet, capacity),
+	}
+}
+
+// 更新队列长度的历史最大值
+func (this *inboundQueue) updateMaxDepth() {
+	depth := int32(len(this.packets))
+	for {
+		maxDepth := atomic.LoadInt32(&this.maxDepth)
+		if depth <= maxDepth || atomic.CompareAndSwapInt32(&this.maxDepth, maxDepth, depth) {
+			return
+		}
+	}
+}
+
+// 收包协程收到一个完整的数据包
+// 没有设置收包队列时,直接调用handler.OnRecvPacket
+// 返回false表示连接被断开,收包协程需要结束
+func (this *baseConnection) recvPacket(connection Connection, packet Packet) bool {
+	queue := this.inboundQueue
+	if queue == nil {
+		if this.handler != nil {
+			this.handler.OnRecvPacket(connection, packet)
+		}
+		return true
+	}
+	pushed, ok := this.pushInboundPacket(connection, queue, packet)
+	if !ok {
+		return false
+	}
+	if !pushed {
+		return true
+	}
+	atomic.AddUint64(&queue.enqueuedCount, 1)
+	queue.updateMaxDepth()
+	if highWaterMark := int(queue.config.HighWaterMark); highWaterMark > 0 && len(queue.packets) >= highWaterMark {
+		this.setQueueReadPaused(true)
+		// 投递协程可能在暂停之前就已经把队列消耗到低水位了
+		if len(queue.packets) <= int(queue.config.LowWaterMark) {
+			this.setQueueReadPaused(false)
+		}
+	}
+	return true
+}
+
+// 数据包放入收包队列,收包队列满时,按照InboundQueueConfig.OverflowPolicy处理
+// pushed:是否放入了收包队列 ok:false表示连接被断开
+func (this *baseConnection) pushInboundPacket(connection Connection, queue *inboundQueue, packet Packet) (pushed, ok bool) {
+	policy := queue.config.OverflowPolicy
+	if policy == InboundOverflowBlock {
+		select {
+		case queue.packets <- packet:
+		case <-this.closeNotify:
+			atomic.AddUint64(&queue.droppedCount, 1)
+			return false, false
+		}
+		return true, true
+	}
+	// 非阻塞方式写chan
+	select {
+	case queue.packets <- packet:
+		return true, true
+	default:
+	}
+	switch policy {
+	case InboundOverflowDropOldest:
+		if cap(queue.packets) == 0 {
+			// 没有缓存的数据包可以丢弃,按InboundOverflowDropNewest处理,避免空转
+			break
+		}
+		for {
+			select {
+			case oldPacket := <-queue.packets:
+				// 投递协程可能同时在读取,所以取出的也可能不是最早的那个
+				this.onInboundOverflow(connection, queue, oldPacket, policy)
+			default:
+			}
+			// 先尝试写入,有空位时不再丢弃
+			select {
+			case queue.packets <- packet:
+				return true, true
+			default:
+			}
+		}
+	case InboundOverflowDisconnect:
+		logger.Debug("%v inbound overflow disconnect", this.GetConnectionId())
+		this.onInboundOverflow(connection, queue, packet, policy)
+		closeWithReason(connection, CloseCodeRecvOverflow, ErrRecvOverflow)
+		return false, false
+	}
+	this.onInboundOverflow(connection, queue, packet, policy)
+	return false, true
+}
+
+func (this *baseConnection) onInboundOverflow(connection Connection, queue *inboundQueue, packet Packet, policy InboundOverflowPolicy) {
+	atomic.AddUint64(&queue.droppedCount, 1)
+	if queue.config.OnOverflow != nil {
+		queue.config.OnOverflow(connection, packet, policy)
+	}
+}
+
+// 开启投递协程
+// ctx:Start传入的ctx,ctx结束时不再投递剩余的数据包
+func (this *baseConnection) startInboundDelivery(connection Connection, ctx context.Context, netMgrWg *sync.WaitGroup) {
+	queue := this.inboundQueue
+	if queue == nil {
+		return
+	}
+	netMgrWg.Add(1)
+	go func() {
+		defer func() {
+			netMgrWg.Done()
+			if err := recover(); err != nil {
+				logger.Error("inbound delivery fatal %v: %v", this.GetConnectionId(), err)
+				LogStack()
+				// 和在收包协程里直接调用handler.OnRecvPacket一样,出错时关闭连接
+				closeWithReason(connection, CloseCodeReadError, fmt.Errorf("deliveryLoop fatal: %v", err))
+			}
+		}()
+		this.deliveryLoop(connection, ctx, queue)
+	}()
+}
+
+// 投递过程,按顺序投递收包队列里的数据包
+func (this *baseConnection) deliveryLoop(connection Connection, ctx context.Context, queue *inboundQueue) {
+	logger.Debug("deliveryLoop begin %v", this.GetConnectionId())
+	for packet := range queue.packets {
+		if this.State() == ConnectionStateClosed && (atomic.LoadInt32(&queue.draining) == 0 || ctx.Err() != nil) {
+			// 连接已经关闭,剩余的数据包不再投递
+			atomic.AddUint64(&queue.droppedCount, 1)
+			continue
+		}
+		if queue.config.HighWaterMark > 0 && len(queue.packets) <= int(queue.config.LowWaterMark) {
+			this.setQueueReadPaused(false)
+		}
+		if queue.config.Dispatcher != nil {
+			queue.config.Dispatcher(connection, packet)
+		} else if this.handler != nil {
+			this.handler.OnRecvPacket(connection, packet)
+		}
+		atomic.AddUint64(&queue.deliveredCount, 1)
+	}
+	logger.Debug("deliveryLoop end %v", this.GetConnectionId())
+}
+
+// 收包协程读取到EOF时调用,对方正常关闭了连接,之前收到的数据包在连接关闭后继续投递
+// 不能根据关闭原因判断,本地先调用CloseGracefully时,记录的关闭原因是Graceful
+func (this *baseConnection) onPeerEOF() {
+	if this.inboundQueue != nil {
+		atomic.StoreInt32(&this.inboundQueue.draining, 1)
+	}
+}
+
+// 收包协程结束后,关闭连接之前调用,不等待收包队列里的数据包投递完,
+// 避免Dispatcher阻塞时连接无法关闭
+// 对方正常关闭连接之前发送的数据包,在连接关闭后由投递协程继续投递
+func (this *baseConnection) stopInboundDelivery() {
+	queue := this.inboundQueue
+	if queue == nil {
+		return
+	}
+	queue.closeOnce.Do(func() {
+		close(queue.packets)
+	})
+}
+
+// 收包队列统计,没有设置收包队列时返回空的统计
+func (this *baseConnection) GetInboundQueueStats() InboundQueueStats {
+	queue := this.inboundQueue
+	if queue == nil {
+		return InboundQueueStats{}
+	}
+	return InboundQueueStats{
+		Depth:     len(queue.packets),
+		Capacity:  cap(queue.packets),
+		MaxDepth:  int(atomic.LoadInt32(&queue.maxDepth)),
+		Enqueued:  atomic.LoadUint64(&queue.enqueuedCount),
+		Delivered: atomic.LoadUint64(&queue.deliveredCount),
+		Dropped:   atomic.LoadUint64(&queue.droppedCount),
+	}
+}
@@ -0,0 +1,109 @@
+package gnet
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInboundQueueWaterMark(t *testing.T) {
+	var delivered []int
+	deliverLock := sync.Mutex{}
+	blockDelivery := make(chan struct{})
+	deliveryEntered := make(chan struct{}, 8)
+	connection := newTestConnection(&ConnectionConfig{
+		SendPacketCacheCap: 1,
+		InboundQueue: &InboundQueueConfig{
+			Capacity:      8,
+			HighWaterMark: 4,
+			LowWaterMark:  1,
+			Dispatcher: func(connection Connection, packet Packet) {
+				deliveryEntered <- struct{}{}
+				<-blockDelivery
+				deliverLock.Lock()
+				delivered = append(delivered, int(packet.GetStreamData()[0]))
+				deliverLock.Unlock()
+			},
+		},
+	}, nil, nil)
+	var wg sync.WaitGroup
+	connection.startInboundDelivery(connection, context.Background(), &wg)
+	// 投递协程阻塞在第一个数据包,队列里堆积4个时暂停读取
+	connection.recvPacket(connection, NewDataPacket([]byte{0}))
+	<-deliveryEntered
+	for i := 1; i < 5; i++ {
+		if !connection.recvPacket(connection, NewDataPacket([]byte{byte(i)})) {
+			t.Fatal("recvPacket failed")
+		}
+	}
+	if !connection.IsReadPaused() {
+		t.Fatalf("not paused stats:%+v", connection.GetInboundQueueStats())
+	}
+	stats := connection.GetInboundQueueStats()
+	if stats.Depth != 4 || stats.Capacity != 8 || stats.MaxDepth != 4 || stats.Enqueued != 5 {
+		t.Fatalf("stats:%+v", stats)
+	}
+	// 投递到低水位时恢复读取
+	close(blockDelivery)
+	if !connection.waitReadResume(connection) {
+		t.Fatal("resume failed")
+	}
+	connection.stopInboundDelivery()
+	wg.Wait()
+	stats = connection.GetInboundQueueStats()
+	if stats.Depth != 0 || stats.Delivered != 5 || stats.Dropped != 0 {
+		t.Fatalf("stats:%+v", stats)
+	}
+	for i, v := range delivered {
+		if i != v {
+			t.Fatalf("delivered:%v", delivered)
+		}
+	}
+}
+
+func TestInboundQueueOverflow(t *testing.T) {
+	var overflowPackets []int
+	onOverflow := func(connection Connection, packet Packet, policy InboundOverflowPolicy) {
+		overflowPackets = append(overflowPackets, int(packet.GetStreamData()[0]))
+	}
+	// 不开启投递协程,队列不会被消耗
+	recvPackets := func(connection *TcpConnection) int {
+		okCount := 0
+		for i := 0; i < 4; i++ {
+			if connection.recvPacket(connection, NewDataPacket([]byte{byte(i)})) {
+				okCount++
+			}
+		}
+		return okCount
+	}
+	connection := newTestConnection(&ConnectionConfig{SendPacketCacheCap: 1, InboundQueue: &InboundQueueConfig{Capacity: 2, OverflowPolicy: InboundOverflowDropNewest, OnOverflow: onOverflow}}, nil, nil)
+	if recvPackets(connection) != 4 || len(overflowPackets) != 2 || overflowPackets[0] != 2 || overflowPackets[1] != 3 {
+		t.Fatalf("overflowPackets:%v", overflowPackets)
+	}
+	if stats := connection.GetInboundQueueStats(); stats.Enqueued != 2 || stats.Dropped != 2 {
+		t.Fatalf("stats:%+v", stats)
+	}
+
+	overflowPackets = nil
+	connection = newTestConnection(&ConnectionConfig{SendPacketCacheCap: 1, InboundQueue: &InboundQueueConfig{Capacity: 2, OverflowPolicy: InboundOverflowDropOldest, OnOverflow: onOverflow}}, nil, nil)
+	if recvPackets(connection) != 4 || len(overflowPackets) != 2 || overflowPackets[0] != 0 || overflowPackets[1] != 1 {
+		t.Fatalf("overflowPackets:%v", overflowPackets)
+	}
+
+	overflowPackets = nil
+	connection = newTestConnection(&ConnectionConfig{SendPacketCacheCap: 1, InboundQueue: &InboundQueueConfig{Capacity: 2, OverflowPolicy: InboundOverflowDisconnect, OnOverflow: onOverflow}}, nil, nil)
+	if recvPackets(connection) != 2 || connection.IsConnected() || connection.GetCloseReason().Code != CloseCodeRecvOverflow {
+		t.Fatalf("reason:%v", connection.GetCloseReason())
+	}
+
+	// 阻塞模式下,连接关闭时不再阻塞
+	connection = newTestConnection(&ConnectionConfig{SendPacketCacheCap: 1, InboundQueue: &InboundQueueConfig{Capacity: 2}}, nil, nil)
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		connection.Close()
+	}()
+	if recvPackets(connection) != 2 {
+		t.Fatal("block failed")
+	}
+}
@@ -0,0 +1,359 @@
+package gnet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	// 下发消息号表的消息号(协商模式)
+	MessageCommandTableCommand PacketCommand = 0xFFFF
+)
+
+// 根据proto消息全名计算消息号(哈希模式)
+// FNV-1a 32位哈希,再折叠成16位
+// NOTE:消息号只有16位,消息数量达到300左右时,出现哈希冲突的概率就有50%左右,
+// 新增一个消息也可能和已有的消息冲突,所以消息较多时应该使用协商模式
+func MessageCommandByName(fullName protoreflect.FullName) PacketCommand {
+	h := fnv.New32a()
+	h.Write([]byte(fullName))
+	sum := h.Sum32()
+	return PacketCommand(sum>>16 ^ sum&0xFFFF)
+}
+
+// 以proto消息全名为key的消息注册表,不需要手动分配消息号,网络上传输的仍然是uint16的消息号
+// 消息号有2种生成方式:
+//  协商模式(默认,NewMessageRegistry): 注册时按顺序分配本地的消息号,服务器可以调用AssignCommands按消息名排序重新分配,
+//    连接建立时用NewCommandTablePacket下发消息号表,客户端(connector)收到后保存在该连接上,
+//    收发包时由codec在本地消息号和对方的消息号之间转换,本地的注册表不变
+//  哈希模式(NewHashMessageRegistry): 消息号由消息全名的哈希值生成,双方不需要交互,哈希冲突时注册失败,见MessageCommandByName
+// 已经被handler手动注册的消息号(如心跳包)不会分配给注册表里的消息
+// 消息通过protoregistry.GlobalTypes创建
+// NOTE:注册和AssignCommands不支持多线程,应该在程序启动时完成
+type MessageRegistry struct {
+	handler *DefaultConnectionHandler
+	// 是否使用哈希模式
+	hashCommand bool
+	// 消息全名和消息号的映射
+	nameToCommand map[protoreflect.FullName]PacketCommand
+	commandToName map[PacketCommand]protoreflect.FullName
+	// 消息回调
+	packetHandlers map[protoreflect.FullName]PacketHandler
+	// 协商模式下,对方下发的消息号表,保存在连接上
+	commandTableAttr *Attr[*connectionCommandTable]
+}
+
+// 协商模式下,连接使用的消息号表
+// 创建后不再修改,收包协程和发包协程可以并发读取
+type connectionCommandTable struct {
+	localToRemote map[PacketCommand]PacketCommand
+	remoteToLocal map[PacketCommand]PacketCommand
+}
+
+// 创建协商模式的消息注册表
+// 注册的消息和回调会同步注册到handler和handler的codec
+func NewMessageRegistry(handler *DefaultConnectionHandler) *MessageRegistry {
+	return newMessageRegistry(handler, false)
+}
+
+// 创建哈希模式的消息注册表,消息号由消息全名的哈希值生成
+func NewHashMessageRegistry(handler *DefaultConnectionHandler) *MessageRegistry {
+	return newMessageRegistry(handler, true)
+}
+
+func newMessageRegistry(handler *DefaultConnectionHandler, hashCommand bool) *MessageRegistry {
+	registry := &MessageRegistry{
+		hashCommand:      hashCommand,
+		handler:          handler,
+		nameToCommand:    make(map[protoreflect.FullName]PacketCommand),
+		commandToName:    make(map[PacketCommand]protoreflect.FullName),
+		packetHandlers:   make(map[protoreflect.FullName]PacketHandler),
+		commandTableAttr: NewAttr[*connectionCommandTable]("gnet.MessageRegistry.commandTable"),
+	}
+	// 协商模式下,收到服务器下发的消息号表
+	handler.Register(MessageCommandTableCommand, func(connection Connection, packet *ProtoPacket) {
+		if err := registry.ApplyCommandTable(connection, packet.GetStreamData()); err != nil {
+			logger.Error("%v ApplyCommandTable err:%v", connection.GetConnectionId(), err)
+		}
+	}, nil)
+	// 消息号表不是proto消息,只注册消息号
+	if protoRegister, ok := handler.protoCodec.(ProtoRegister); ok {
+		protoRegister.Register(MessageCommandTableCommand, nil)
+	}
+	// 收发包时按照连接上的消息号表转换消息号
+	if commandMapperSetter, ok := handler.protoCodec.(interface{ SetCommandMapper(commandMapper CommandMapper) }); ok {
+		commandMapperSetter.SetCommandMapper(registry)
+	}
+	return registry
+}
+
+// 按消息类型注册消息回调
+// 协商模式下按顺序分配未使用的消息号,哈希模式下消息号由消息全名的哈希值生成,哈希冲突时返回错误
+// handler可以为nil,表示只注册消息
+func (this *MessageRegistry) Register(message proto.Message, handler PacketHandler) (PacketCommand, error) {
+	return this.RegisterByName(message.ProtoReflect().Descriptor().FullName(), handler)
+}
+
+// 按消息全名注册消息回调,消息类型需要已经注册到protoregistry.GlobalTypes
+func (this *MessageRegistry) RegisterByName(fullName protoreflect.FullName, handler PacketHandler) (PacketCommand, error) {
+	if _, err := protoregistry.GlobalTypes.FindMessageByName(fullName); err != nil {
+		return 0, err
+	}
+	if _, ok := this.nameToCommand[fullName]; ok {
+		return 0, fmt.Errorf("message %v already registered", fullName)
+	}
+	var command PacketCommand
+	if this.hashCommand {
+		command = MessageCommandByName(fullName)
+		if command == 0 || command == MessageCommandTableCommand {
+			return 0, fmt.Errorf("message %v command %v reserved", fullName, command)
+		}
+		if existName, ok := this.commandToName[command]; ok {
+			return 0, fmt.Errorf("message %v command %v conflict with %v", fullName, command, existName)
+		}
+	} else {
+		command = this.nextFreeCommand(1)
+	}
+	this.packetHandlers[fullName] = handler
+	if err := this.registerToHandler(command, fullName); err != nil {
+		delete(this.packetHandlers, fullName)
+		return 0, err
+	}
+	this.nameToCommand[fullName] = command
+	this.commandToName[command] = fullName
+	return command, nil
+}
+
+// 获取消息对应的消息号
+func (this *MessageRegistry) GetCommand(message proto.Message) (PacketCommand, bool) {
+	command, ok := this.nameToCommand[message.ProtoReflect().Descriptor().FullName()]
+	return command, ok
+}
+
+// 获取消息号对应的消息全名
+func (this *MessageRegistry) GetMessageName(command PacketCommand) protoreflect.FullName {
+	return this.commandToName[command]
+}
+
+// 创建消息号对应的消息
+func (this *MessageRegistry) CreateMessage(command PacketCommand) proto.Message {
+	if fullName, ok := this.commandToName[command]; ok {
+		return createMessageByName(fullName)
+	}
+	return nil
+}
+
+// 创建数据包,消息号由注册表获取
+func (this *MessageRegistry) NewPacket(message proto.Message) *ProtoPacket {
+	command, ok := this.GetCommand(message)
+	if !ok {
+		logger.Error("message %v not registered", message.ProtoReflect().Descriptor().FullName())
+		return nil
+	}
+	return NewProtoPacket(command, message)
+}
+
+// 发送消息,消息号由注册表获取
+func (this *MessageRegistry) Send(connection Connection, message proto.Message) bool {
+	packet := this.NewPacket(message)
+	if packet == nil {
+		return false
+	}
+	return connection.SendPacket(packet)
+}
+
+// 协商模式:按消息全名排序,从1开始重新分配消息号,跳过已经被handler手动注册的消息号
+// 一般由服务器在注册完所有消息后调用,使消息号和注册顺序无关
+func (this *MessageRegistry) AssignCommands() error {
+	names := make([]protoreflect.FullName, 0, len(this.nameToCommand))
+	for fullName := range this.nameToCommand {
+		names = append(names, fullName)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i] < names[j]
+	})
+	return this.applyCommands(names)
+}
+
+// 协商模式:创建下发给对方的消息号表
+// 格式: (command uint16|nameLen uint16|name)...
+func (this *MessageRegistry) NewCommandTablePacket() *ProtoPacket {
+	size := 0
+	for fullName := range this.nameToCommand {
+		size += 4 + len(fullName)
+	}
+	data := make([]byte, 0, size)
+	for fullName, command := range this.nameToCommand {
+		data = append(data, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint16(data[len(data)-4:], uint16(command))
+		binary.LittleEndian.PutUint16(data[len(data)-2:], uint16(len(fullName)))
+		data = append(data, fullName...)
+	}
+	return NewProtoPacketWithData(MessageCommandTableCommand, data)
+}
+
+// 协商模式:该连接使用对方下发的消息号表
+// 消息号表保存在连接上,不修改本地的注册表,所以可以在收包协程中调用
+// 本地没有注册的消息会被忽略
+// 对方的消息号和本地其他消息的消息号冲突时返回错误,该连接仍然使用本地的消息号
+// 只有connector接受消息号表,否则任何客户端都可以修改服务器上该连接的消息号
+func (this *MessageRegistry) ApplyCommandTable(connection Connection, data []byte) error {
+	if !connection.IsConnector() {
+		return fmt.Errorf("command table not accepted by accepted connection")
+	}
+	table := &connectionCommandTable{
+		localToRemote: make(map[PacketCommand]PacketCommand),
+		remoteToLocal: make(map[PacketCommand]PacketCommand),
+	}
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return ErrPacketLength
+		}
+		command := PacketCommand(binary.LittleEndian.Uint16(data))
+		nameLen := int(binary.LittleEndian.Uint16(data[2:]))
+		if len(data) < 4+nameLen {
+			return ErrPacketLength
+		}
+		fullName := protoreflect.FullName(data[4 : 4+nameLen])
+		data = data[4+nameLen:]
+		localCommand, ok := this.nameToCommand[fullName]
+		if !ok {
+			continue
+		}
+		if command == 0 || command == MessageCommandTableCommand {
+			return fmt.Errorf("message %v command %v reserved", fullName, command)
+		}
+		if existCommand, ok := table.remoteToLocal[command]; ok {
+			return fmt.Errorf("message %v command %v conflict with %v", fullName, command, this.commandToName[existCommand])
+		}
+		table.localToRemote[localCommand] = command
+		table.remoteToLocal[command] = localCommand
+	}
+	// 对方的消息号不能和本地没有转换的消息号重复,否则收到该消息号时无法区分
+	for remoteCommand, localCommand := range table.remoteToLocal {
+		if existName, ok := this.commandToName[remoteCommand]; ok && remoteCommand != localCommand {
+			if _, mapped := table.localToRemote[remoteCommand]; !mapped {
+				return fmt.Errorf("message %v command %v conflict with %v", this.commandToName[localCommand], remoteCommand, existName)
+			}
+		}
+	}
+	this.commandTableAttr.Set(connection, table)
+	return nil
+}
+
+// 获取该连接上消息对应的消息号(协商模式下是对方的消息号)
+func (this *MessageRegistry) GetConnectionCommand(connection Connection, message proto.Message) (PacketCommand, bool) {
+	command, ok := this.GetCommand(message)
+	if !ok {
+		return 0, false
+	}
+	return this.ToRemoteCommand(connection, command), true
+}
+
+// 本地的消息号转换成该连接上对方的消息号
+func (this *MessageRegistry) ToRemoteCommand(connection Connection, command PacketCommand) PacketCommand {
+	if table := this.commandTableAttr.GetOrZero(connection); table != nil {
+		if remoteCommand, ok := table.localToRemote[command]; ok {
+			return remoteCommand
+		}
+	}
+	return command
+}
+
+// 该连接上对方的消息号转换成本地的消息号
+func (this *MessageRegistry) ToLocalCommand(connection Connection, command PacketCommand) PacketCommand {
+	if table := this.commandTableAttr.GetOrZero(connection); table != nil {
+		if localCommand, ok := table.remoteToLocal[command]; ok {
+			return localCommand
+		}
+	}
+	return command
+}
+
+// 按顺序给消息分配新的消息号,同步更新handler和codec
+// 会修改handler和codec的注册表,只能在程序启动时调用
+func (this *MessageRegistry) applyCommands(names []protoreflect.FullName) error {
+	for _, fullName := range names {
+		oldCommand := this.nameToCommand[fullName]
+		if this.commandToName[oldCommand] == fullName {
+			delete(this.commandToName, oldCommand)
+			this.unregisterFromHandler(oldCommand)
+		}
+	}
+	command := PacketCommand(0)
+	for _, fullName := range names {
+		command = this.nextFreeCommand(command + 1)
+		if err := this.registerToHandler(command, fullName); err != nil {
+			delete(this.nameToCommand, fullName)
+			return err
+		}
+		this.nameToCommand[fullName] = command
+		this.commandToName[command] = fullName
+	}
+	return nil
+}
+
+// 从command开始查找未使用的消息号,没有时返回0
+func (this *MessageRegistry) nextFreeCommand(command PacketCommand) PacketCommand {
+	for ; command != 0 && command < MessageCommandTableCommand; command++ {
+		if _, ok := this.commandToName[command]; !ok && !this.isCommandUsedByOthers(command) {
+			return command
+		}
+	}
+	return 0
+}
+
+// 消息号是否已经被其他方式注册,如handler手动注册的消息和心跳包
+func (this *MessageRegistry) isCommandUsedByOthers(command PacketCommand) bool {
+	if this.handler.HasPacketHandler(command) {
+		return true
+	}
+	if this.handler.heartBeatCreator != nil && this.handler.heartBeatCommand == command {
+		return true
+	}
+	if protoCodec, ok := this.handler.protoCodec.(*ProtoCodec); ok && protoCodec.MessageCreatorMap[command] != nil {
+		return true
+	}
+	return false
+}
+
+// 注册到handler和codec,消息号已经被其他方式注册时返回错误
+func (this *MessageRegistry) registerToHandler(command PacketCommand, fullName protoreflect.FullName) error {
+	if command == 0 {
+		return fmt.Errorf("no free command for message %v", fullName)
+	}
+	if this.isCommandUsedByOthers(command) {
+		return fmt.Errorf("message %v command %v already registered by handler", fullName, command)
+	}
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(fullName)
+	if err != nil {
+		return err
+	}
+	this.handler.Register(command, this.packetHandlers[fullName], func() proto.Message {
+		return messageType.New().Interface()
+	})
+	return nil
+}
+
+func (this *MessageRegistry) unregisterFromHandler(command PacketCommand) {
+	delete(this.handler.PacketHandlers, command)
+	if protoUnregister, ok := this.handler.protoCodec.(interface{ Unregister(command PacketCommand) }); ok {
+		protoUnregister.Unregister(command)
+	}
+}
+
+// 通过protoregistry创建消息
+func createMessageByName(fullName protoreflect.FullName) proto.Message {
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(fullName)
+	if err != nil {
+		logger.Error("FindMessageByName %v err:%v", fullName, err)
+		return nil
+	}
+	return messageType.New().Interface()
+}
@@ -0,0 +1,121 @@
+package gnet
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestMessageRegistry(t *testing.T) {
+	var recvValue string
+	onStringValue := func(connection Connection, packet *ProtoPacket) {
+		recvValue = packet.Message().(*wrapperspb.StringValue).GetValue()
+	}
+	newRegistry := func(hashCommand bool) (*MessageRegistry, *ProtoCodec) {
+		codec := NewProtoCodec(nil)
+		handler := NewDefaultConnectionHandler(codec)
+		var registry *MessageRegistry
+		if hashCommand {
+			registry = NewHashMessageRegistry(handler)
+		} else {
+			// 手动注册的消息号不会分配给注册表里的消息
+			handler.Register(1, func(connection Connection, packet *ProtoPacket) {}, nil)
+			registry = NewMessageRegistry(handler)
+		}
+		for _, message := range []proto.Message{&wrapperspb.Int32Value{}, &wrapperspb.StringValue{}} {
+			if _, err := registry.Register(message, onStringValue); err != nil {
+				t.Fatalf("Register err:%v", err)
+			}
+		}
+		return registry, codec
+	}
+
+	// 哈希模式
+	registry, codec := newRegistry(true)
+	command, _ := registry.GetCommand(&wrapperspb.StringValue{})
+	if command != MessageCommandByName("google.protobuf.StringValue") || codec.MessageCreatorMap[command] == nil {
+		t.Fatalf("command:%v", command)
+	}
+	if _, err := registry.Register(&wrapperspb.StringValue{}, nil); err == nil {
+		t.Fatal("duplicate register")
+	}
+
+	// 协商模式,按注册顺序分配消息号,跳过手动注册的消息号1
+	serverRegistry, _ := newRegistry(false)
+	if command, _ = serverRegistry.GetCommand(&wrapperspb.Int32Value{}); command != 2 {
+		t.Fatalf("command:%v", command)
+	}
+	if err := serverRegistry.AssignCommands(); err != nil {
+		t.Fatalf("AssignCommands err:%v", err)
+	}
+	command, _ = serverRegistry.GetCommand(&wrapperspb.StringValue{})
+	if command != 3 {
+		t.Fatalf("command:%v", command)
+	}
+	tablePacket := serverRegistry.NewCommandTablePacket()
+	// 服务器上的连接不接受对方下发的消息号表
+	serverConnection, _ := newCodecTestConnections(codec, &ConnectionConfig{SendBufferSize: 64, RecvBufferSize: 64, MaxPacketSize: 64})
+	if err := registry.ApplyCommandTable(serverConnection, tablePacket.GetStreamData()); err == nil {
+		t.Fatal("accepted connection applied command table")
+	}
+	// 模拟客户端收到服务器下发的消息号表
+	clientConnection, _ := newCodecTestConnections(codec, &ConnectionConfig{SendBufferSize: 64, RecvBufferSize: 64, MaxPacketSize: 64})
+	clientConnection.isConnector = true
+	registry.handler.OnRecvPacket(clientConnection, tablePacket)
+	if clientCommand, _ := registry.GetConnectionCommand(clientConnection, &wrapperspb.StringValue{}); clientCommand != command {
+		t.Fatalf("clientCommand:%v command:%v", clientCommand, command)
+	}
+	// 消息号表保存在连接上,本地的注册表不变
+	if localCommand, _ := registry.GetCommand(&wrapperspb.StringValue{}); localCommand != MessageCommandByName("google.protobuf.StringValue") {
+		t.Fatalf("localCommand:%v", localCommand)
+	}
+	if len(codec.MessageCreatorMap) != 3 || len(registry.handler.PacketHandlers) != 3 {
+		t.Fatalf("creators:%v handlers:%v", len(codec.MessageCreatorMap), len(registry.handler.PacketHandlers))
+	}
+	// 发出去的是对方的消息号
+	encodedData := codec.EncodePacket(clientConnection, registry.NewPacket(wrapperspb.String("hello")))
+	if PacketCommand(encodedData[0][0])|PacketCommand(encodedData[0][1])<<8 != command {
+		t.Fatalf("encoded command:%v", encodedData[0])
+	}
+	// 收到的对方的消息号转换成本地的消息号
+	packet := codec.DecodePacket(clientConnection, nil, append(encodedData[0], encodedData[1]...))
+	registry.handler.OnRecvPacket(clientConnection, packet)
+	if packet.Command() != MessageCommandByName("google.protobuf.StringValue") || recvValue != "hello" {
+		t.Fatalf("packet:%v recvValue:%v", packet, recvValue)
+	}
+	// 其他连接不受影响
+	encodedData = codec.EncodePacket(nil, registry.NewPacket(wrapperspb.String("hello")))
+	if packet = codec.DecodePacket(nil, nil, append(encodedData[0], encodedData[1]...)); packet.Command() != MessageCommandByName("google.protobuf.StringValue") {
+		t.Fatalf("packet:%v", packet)
+	}
+
+	// 对方的消息号和本地没有转换的消息号冲突
+	conflictConnection, _ := newCodecTestConnections(codec, &ConnectionConfig{SendBufferSize: 64, RecvBufferSize: 64, MaxPacketSize: 64})
+	conflictConnection.isConnector = true
+	conflictName := "google.protobuf.Int32Value"
+	conflictData := []byte{0, 0, byte(len(conflictName)), 0}
+	binary.LittleEndian.PutUint16(conflictData, uint16(MessageCommandByName("google.protobuf.StringValue")))
+	conflictData = append(conflictData, conflictName...)
+	if err := registry.ApplyCommandTable(conflictConnection, conflictData); err == nil {
+		t.Fatal("command conflict")
+	}
+	if _, ok := registry.commandTableAttr.Get(conflictConnection); ok {
+		t.Fatal("conflict table applied")
+	}
+}
+
+// 哈希模式下,消息号和手动注册的消息号冲突时返回错误,而不是panic
+func TestMessageRegistryHashConflict(t *testing.T) {
+	codec := NewProtoCodec(nil)
+	handler := NewDefaultConnectionHandler(codec)
+	handler.Register(MessageCommandByName("google.protobuf.StringValue"), func(connection Connection, packet *ProtoPacket) {}, nil)
+	registry := NewHashMessageRegistry(handler)
+	if _, err := registry.Register(&wrapperspb.StringValue{}, func(connection Connection, packet *ProtoPacket) {}); err == nil {
+		t.Fatal("conflict with handler")
+	}
+	if _, ok := registry.GetCommand(&wrapperspb.StringValue{}); ok {
+		t.Fatal("conflict message registered")
+	}
+}
@@ -10,9 +10,15 @@ const (
 	// 默认包头长度
 	DefaultPacketHeaderSize = int(unsafe.Sizeof(DefaultPacketHeader{}))
 	// 数据包长度限制(16M)
+	// 超出该长度的数据包,TcpConnection会自动分片发送,接收方自动重组
 	MaxPacketDataSize = 0x00FFFFFF
 )
 
+const (
+	// DefaultPacketHeader的标记:该数据包是一个分片,后面还有分片
+	PacketFlagFragment uint8 = 1 << 7
+)
+
 // 包头接口
 type PacketHeader interface {
 	Len() uint32
@@ -0,0 +1,363 @@
+package gnet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// 包头字段类型
+type PacketHeaderFieldType uint8
+
+const (
+	// 包体长度
+	PacketHeaderFieldLen PacketHeaderFieldType = iota
+	// 消息号
+	PacketHeaderFieldCommand
+	// 序列号,每个连接从1开始,每发一个数据包加1
+	// 解码时要求序列号连续(超出字段的表示范围时回绕),否则返回ErrPacketHeaderSequence
+	// 只能检测丢包和乱序,防重放和防篡改需要使用PacketSequenceConfig
+	PacketHeaderFieldSequence
+	// 发送时间戳(毫秒)
+	PacketHeaderFieldTimestamp
+	// 自定义字段,如traceId,编码时通过PacketHeaderField.Value获取
+	PacketHeaderFieldCustom
+)
+
+// 包头字段
+type PacketHeaderField struct {
+	Type PacketHeaderFieldType
+	// 字段名,用于LayoutPacketHeader.Field查询
+	Name string
+	// 字节数: 1,2,4,8
+	// 0表示varint编码
+	Size int
+	// 自定义字段的取值接口,只对PacketHeaderFieldCustom有效
+	Value func(connection Connection, packet Packet) uint64
+}
+
+// 声明式的包头格式,用于对接已有的客户端协议
+// 字段按Fields的顺序排列,必须有且只有一个PacketHeaderFieldLen
+// 示例: 2字节大端长度+2字节消息号+8字节traceId
+//  NewPacketHeaderLayout(binary.BigEndian, false,
+//    PacketHeaderField{Type: PacketHeaderFieldLen, Size: 2},
+//    PacketHeaderField{Type: PacketHeaderFieldCommand, Size: 2},
+//    PacketHeaderField{Type: PacketHeaderFieldCustom, Name: "traceId", Size: 8, Value: getTraceId})
+type PacketHeaderLayout struct {
+	// 字节序
+	ByteOrder binary.ByteOrder
+	// 长度字段的值是否包含包头的长度
+	LenIncludeHeader bool
+	// 字段列表
+	Fields []PacketHeaderField
+
+	lenIndex     int
+	commandIndex int
+	maxSize      int
+}
+
+// 创建包头格式,byteOrder为nil时使用小端字节序
+// NOTE:格式设置错误会panic,应该在程序启动时创建
+func NewPacketHeaderLayout(byteOrder binary.ByteOrder, lenIncludeHeader bool, fields ...PacketHeaderField) *PacketHeaderLayout {
+	if byteOrder == nil {
+		byteOrder = binary.LittleEndian
+	}
+	layout := &PacketHeaderLayout{
+		ByteOrder:        byteOrder,
+		LenIncludeHeader: lenIncludeHeader,
+		Fields:           fields,
+		lenIndex:         -1,
+		commandIndex:     -1,
+	}
+	for i, field := range fields {
+		switch field.Size {
+		case 0:
+			layout.maxSize += binary.MaxVarintLen64
+		case 1, 2, 4, 8:
+			layout.maxSize += field.Size
+		default:
+			panic(fmt.Sprintf("PacketHeaderLayout field %v size error:%v", i, field.Size))
+		}
+		switch field.Type {
+		case PacketHeaderFieldLen:
+			if layout.lenIndex >= 0 {
+				panic("PacketHeaderLayout duplicate len field")
+			}
+			layout.lenIndex = i
+		case PacketHeaderFieldCommand:
+			if layout.commandIndex >= 0 {
+				panic("PacketHeaderLayout duplicate command field")
+			}
+			layout.commandIndex = i
+		case PacketHeaderFieldCustom:
+			if field.Value == nil {
+				panic(fmt.Sprintf("PacketHeaderLayout custom field %v Value is nil", i))
+			}
+		}
+	}
+	if layout.lenIndex < 0 {
+		panic("PacketHeaderLayout need a len field")
+	}
+	return layout
+}
+
+// 包头的最大长度,使用了varint字段时,实际长度可能小于该值
+func (this *PacketHeaderLayout) MaxSize() int {
+	return this.maxSize
+}
+
+// 消息号是否在包头里
+func (this *PacketHeaderLayout) HasCommand() bool {
+	return this.commandIndex >= 0
+}
+
+// 按照PacketHeaderLayout编解码的包头
+type LayoutPacketHeader struct {
+	layout *PacketHeaderLayout
+	// 与layout.Fields一一对应
+	values []uint64
+	// 编码后的包头长度
+	size int
+}
+
+func NewLayoutPacketHeader(layout *PacketHeaderLayout) *LayoutPacketHeader {
+	return &LayoutPacketHeader{
+		layout: layout,
+		values: make([]uint64, len(layout.Fields)),
+	}
+}
+
+// 包体长度,不包含包头的长度
+// Decode时已经校验过长度,这里不会溢出
+func (this *LayoutPacketHeader) Len() uint32 {
+	packetLen := this.values[this.layout.lenIndex]
+	if this.layout.LenIncludeHeader {
+		packetLen -= uint64(this.size)
+	}
+	return uint32(packetLen)
+}
+
+// 包体长度是否合法
+func (this *LayoutPacketHeader) checkLen() bool {
+	packetLen := this.values[this.layout.lenIndex]
+	if this.layout.LenIncludeHeader {
+		if packetLen < uint64(this.size) {
+			return false
+		}
+		packetLen -= uint64(this.size)
+	}
+	return packetLen <= MaxBigPacketDataSize
+}
+
+// 包体长度是否可以用长度字段表示
+// 在分配序列号之前检查,避免编码失败时浪费序列号
+// 包头里有varint字段时,按照包头的最大长度做保守的判断
+func (this *PacketHeaderLayout) canEncodeLen(packetLen uint64) bool {
+	if packetLen > MaxBigPacketDataSize {
+		return false
+	}
+	lenField := this.Fields[this.lenIndex]
+	if this.LenIncludeHeader {
+		packetLen += uint64(this.maxSize)
+	}
+	return lenField.Size == 0 || lenField.Size == 8 || packetLen < 1<<(lenField.Size*8)
+}
+
+// 设置包体长度,不包含包头的长度
+// 长度超出字段的表示范围时返回false
+func (this *LayoutPacketHeader) SetLen(packetLen uint32) bool {
+	this.values[this.layout.lenIndex] = uint64(packetLen)
+	this.size = this.encodeSize()
+	if this.layout.LenIncludeHeader {
+		// varint的长度字段,加上包头长度后,包头长度可能会变
+		for {
+			this.values[this.layout.lenIndex] = uint64(packetLen) + uint64(this.size)
+			newSize := this.encodeSize()
+			if newSize == this.size {
+				break
+			}
+			this.size = newSize
+		}
+	}
+	lenField := this.layout.Fields[this.layout.lenIndex]
+	return lenField.Size == 0 || lenField.Size == 8 || this.values[this.layout.lenIndex] < 1<<(lenField.Size*8)
+}
+
+// 消息号,包头里没有消息号时返回0
+func (this *LayoutPacketHeader) Command() PacketCommand {
+	if this.layout.commandIndex < 0 {
+		return 0
+	}
+	return PacketCommand(this.values[this.layout.commandIndex])
+}
+
+// 根据字段名获取字段值
+func (this *LayoutPacketHeader) Field(name string) uint64 {
+	for i, field := range this.layout.Fields {
+		if field.Name == name {
+			return this.values[i]
+		}
+	}
+	return 0
+}
+
+// 根据字段类型获取字段值,如PacketHeaderFieldSequence,PacketHeaderFieldTimestamp
+func (this *LayoutPacketHeader) FieldByType(fieldType PacketHeaderFieldType) uint64 {
+	for i, field := range this.layout.Fields {
+		if field.Type == fieldType {
+			return this.values[i]
+		}
+	}
+	return 0
+}
+
+// 编码后的包头长度
+func (this *LayoutPacketHeader) Size() int {
+	return this.size
+}
+
+// 填充编码时需要的字段值
+// command:发给对方的消息号
+func (this *LayoutPacketHeader) fill(connection Connection, sequence *packetSequence, packet Packet, command PacketCommand) {
+	for i, field := range this.layout.Fields {
+		switch field.Type {
+		case PacketHeaderFieldCommand:
+			this.values[i] = uint64(command)
+		case PacketHeaderFieldSequence:
+			sequence.headerSequence++
+			this.values[i] = uint64(sequence.headerSequence)
+		case PacketHeaderFieldTimestamp:
+			this.values[i] = uint64(time.Now().UnixNano() / int64(time.Millisecond))
+		case PacketHeaderFieldCustom:
+			this.values[i] = field.Value(connection, packet)
+		}
+	}
+}
+
+// 校验包头里的序列号,必须是上一个序列号+1
+func (this *LayoutPacketHeader) checkSequence(sequence *packetSequence) bool {
+	for i, field := range this.layout.Fields {
+		if field.Type != PacketHeaderFieldSequence {
+			continue
+		}
+		expectSequence := uint64(sequence.recvHeaderSequence + 1)
+		if field.Size > 0 && field.Size < 8 {
+			// 和编码时一样截断
+			expectSequence &= 1<<(field.Size*8) - 1
+		}
+		if this.values[i] != expectSequence {
+			return false
+		}
+		sequence.recvHeaderSequence++
+	}
+	return true
+}
+
+func (this *LayoutPacketHeader) encodeSize() int {
+	size := 0
+	for i, field := range this.layout.Fields {
+		if field.Size == 0 {
+			size += uvarintSize(this.values[i])
+		} else {
+			size += field.Size
+		}
+	}
+	return size
+}
+
+// 从字节流解码包头
+// 返回包头长度,数据不完整时返回0
+// 长度字段的值不合法时返回ErrPacketLength,这时数据流已经无法再解析了
+func (this *LayoutPacketHeader) Decode(messageHeaderData []byte) (int, error) {
+	byteOrder := this.layout.ByteOrder
+	offset := 0
+	for i, field := range this.layout.Fields {
+		if field.Size == 0 {
+			value, n := binary.Uvarint(messageHeaderData[offset:])
+			if n < 0 {
+				// varint溢出
+				return 0, ErrPacketLength
+			}
+			if n == 0 {
+				return 0, nil
+			}
+			this.values[i] = value
+			offset += n
+			continue
+		}
+		if len(messageHeaderData) < offset+field.Size {
+			return 0, nil
+		}
+		data := messageHeaderData[offset:]
+		switch field.Size {
+		case 1:
+			this.values[i] = uint64(data[0])
+		case 2:
+			this.values[i] = uint64(byteOrder.Uint16(data))
+		case 4:
+			this.values[i] = uint64(byteOrder.Uint32(data))
+		case 8:
+			this.values[i] = byteOrder.Uint64(data)
+		}
+		offset += field.Size
+	}
+	this.size = offset
+	if !this.checkLen() {
+		return 0, ErrPacketLength
+	}
+	return offset, nil
+}
+
+// 从字节流读取数据,len(messageHeaderData)>=Size()
+func (this *LayoutPacketHeader) ReadFrom(messageHeaderData []byte) {
+	this.Decode(messageHeaderData)
+}
+
+// 写入字节流,len(messageHeaderData)>=Size()
+func (this *LayoutPacketHeader) WriteTo(messageHeaderData []byte) {
+	offset := 0
+	for i := range this.layout.Fields {
+		offset += this.writeField(messageHeaderData[offset:], i)
+	}
+}
+
+// 除了长度字段之外的包头数据,混入HMAC的计算,防止篡改包头里的消息号等字段
+// 长度字段在HMAC计算之后才能确定,而且篡改长度会导致包体的HMAC校验失败
+func (this *LayoutPacketHeader) fieldsExceptLen() []byte {
+	data := make([]byte, this.layout.maxSize)
+	offset := 0
+	for i := range this.layout.Fields {
+		if i != this.layout.lenIndex {
+			offset += this.writeField(data[offset:], i)
+		}
+	}
+	return data[:offset]
+}
+
+// 写入一个字段,返回写入的字节数
+func (this *LayoutPacketHeader) writeField(data []byte, i int) int {
+	byteOrder := this.layout.ByteOrder
+	switch this.layout.Fields[i].Size {
+	case 0:
+		return binary.PutUvarint(data, this.values[i])
+	case 1:
+		data[0] = uint8(this.values[i])
+	case 2:
+		byteOrder.PutUint16(data, uint16(this.values[i]))
+	case 4:
+		byteOrder.PutUint32(data, uint32(this.values[i]))
+	case 8:
+		byteOrder.PutUint64(data, this.values[i])
+	}
+	return this.layout.Fields[i].Size
+}
+
+// varint编码后的字节数
+func uvarintSize(value uint64) int {
+	size := 1
+	for value >= 0x80 {
+		value >>= 7
+		size++
+	}
+	return size
+}
@@ -0,0 +1,149 @@
+package gnet
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestPacketHeaderLayout(t *testing.T) {
+	traceId := uint64(0x0102030405060708)
+	layouts := []*PacketHeaderLayout{
+		// 2字节大端长度(包含包头)+消息号
+		NewPacketHeaderLayout(binary.BigEndian, true,
+			PacketHeaderField{Type: PacketHeaderFieldLen, Size: 2},
+			PacketHeaderField{Type: PacketHeaderFieldCommand, Size: 2}),
+		// varint长度+消息号+序列号+时间戳+traceId
+		NewPacketHeaderLayout(nil, false,
+			PacketHeaderField{Type: PacketHeaderFieldLen, Size: 0},
+			PacketHeaderField{Type: PacketHeaderFieldCommand, Size: 2},
+			PacketHeaderField{Type: PacketHeaderFieldSequence, Size: 4},
+			PacketHeaderField{Type: PacketHeaderFieldTimestamp, Size: 8},
+			PacketHeaderField{Type: PacketHeaderFieldCustom, Name: "traceId", Size: 8,
+				Value: func(connection Connection, packet Packet) uint64 {
+					return traceId
+				}}),
+		// 消息号在长度前面
+		NewPacketHeaderLayout(binary.BigEndian, false,
+			PacketHeaderField{Type: PacketHeaderFieldCommand, Size: 1},
+			PacketHeaderField{Type: PacketHeaderFieldLen, Size: 8}),
+	}
+	for layoutIndex, layout := range layouts {
+		codec := NewDefaultCodec()
+		codec.HeaderLayout = layout
+		config := &ConnectionConfig{SendBufferSize: 64, RecvBufferSize: 512, MaxPacketSize: 300}
+		sender, receiver := newCodecTestConnections(codec, config)
+		for i := 0; i < 10; i++ {
+			// 数据包大小超过varint的一个字节和sendBuffer的大小
+			packetData := make([]byte, i*30)
+			for j := range packetData {
+				packetData[j] = byte(i + j)
+			}
+			delayData := codec.Encode(sender, NewBigDataPacket(uint16(i+1), packetData))
+			var packet Packet
+			for packet == nil {
+				transferCodecTestData(sender, receiver)
+				if len(delayData) > 0 {
+					n, _ := sender.sendBuffer.Write(delayData)
+					delayData = delayData[n:]
+				}
+				var err error
+				packet, err = codec.Decode(receiver, nil)
+				if err != nil {
+					t.Fatalf("layout:%v decode err:%v", layoutIndex, err)
+				}
+			}
+			if packet.Command() != PacketCommand(i+1) || string(packet.GetStreamData()) != string(packetData) {
+				t.Fatalf("layout:%v packet error cmd:%v len:%v", layoutIndex, packet.Command(), len(packet.GetStreamData()))
+			}
+		}
+		header := receiver.tmpReadPacketHeader.(*LayoutPacketHeader)
+		if layoutIndex == 1 && (header.Field("traceId") != traceId || header.FieldByType(PacketHeaderFieldSequence) != 10) {
+			t.Fatalf("layout:%v traceId:%v sequence:%v", layoutIndex, header.Field("traceId"), header.FieldByType(PacketHeaderFieldSequence))
+		}
+	}
+}
+
+func TestPacketHeaderLayoutLenExceed(t *testing.T) {
+	layout := NewPacketHeaderLayout(nil, false, PacketHeaderField{Type: PacketHeaderFieldLen, Size: 1})
+	header := NewLayoutPacketHeader(layout)
+	if !header.SetLen(255) || header.SetLen(256) {
+		t.Fatal("len check error")
+	}
+}
+
+// 长度字段的值不合法时,返回解码错误,而不是截断长度
+func TestPacketHeaderLayoutInvalidLen(t *testing.T) {
+	layout := NewPacketHeaderLayout(binary.BigEndian, true,
+		PacketHeaderField{Type: PacketHeaderFieldLen, Size: 2},
+		PacketHeaderField{Type: PacketHeaderFieldCommand, Size: 2})
+	header := NewLayoutPacketHeader(layout)
+	// 长度包含包头,但是小于包头长度
+	if _, err := header.Decode([]byte{0, 3, 0, 1}); err != ErrPacketLength {
+		t.Fatalf("err:%v", err)
+	}
+	if size, err := header.Decode([]byte{0, 4, 0, 1}); err != nil || size != 4 || header.Len() != 0 {
+		t.Fatalf("size:%v err:%v", size, err)
+	}
+	// 长度超出MaxBigPacketDataSize
+	bigLayout := NewPacketHeaderLayout(binary.BigEndian, false, PacketHeaderField{Type: PacketHeaderFieldLen, Size: 8})
+	if _, err := NewLayoutPacketHeader(bigLayout).Decode([]byte{0, 0, 0, 1, 0, 0, 0, 0}); err != ErrPacketLength {
+		t.Fatalf("err:%v", err)
+	}
+
+	codec := NewDefaultCodec()
+	codec.HeaderLayout = layout
+	config := &ConnectionConfig{SendBufferSize: 64, RecvBufferSize: 64, MaxPacketSize: 64}
+	_, receiver := newCodecTestConnections(codec, config)
+	receiver.recvBuffer.Write([]byte{0, 3, 0, 1})
+	if _, err := codec.Decode(receiver, nil); err != ErrPacketLength {
+		t.Fatalf("err:%v", err)
+	}
+}
+
+// 长度超出包头的表示范围时,编码失败,并且不消耗序列号
+func TestPacketHeaderLayoutEncodeLenExceed(t *testing.T) {
+	codec := NewDefaultCodec()
+	codec.HeaderLayout = NewPacketHeaderLayout(nil, false,
+		PacketHeaderField{Type: PacketHeaderFieldLen, Size: 1},
+		PacketHeaderField{Type: PacketHeaderFieldSequence, Size: 4})
+	codec.Sequence = &PacketSequenceConfig{}
+	config := &ConnectionConfig{SendBufferSize: 1024, RecvBufferSize: 1024, MaxPacketSize: 1024}
+	sender, receiver := newCodecTestConnections(codec, config)
+	codec.Encode(sender, NewDataPacket(make([]byte, 300)))
+	if sender.sendBuffer.UnReadLength() != 0 || sender.sequence.sendSequence != 0 || sender.sequence.headerSequence != 0 {
+		t.Fatalf("sequence:%+v", sender.sequence)
+	}
+	codec.Encode(sender, NewDataPacket([]byte("hello")))
+	transferCodecTestData(sender, receiver)
+	if packet, err := codec.Decode(receiver, nil); err != nil || packet == nil || string(packet.GetStreamData()) != "hello" {
+		t.Fatalf("packet:%v err:%v", packet, err)
+	}
+}
+
+// 包头里的序列号不连续时,返回解码错误
+func TestPacketHeaderLayoutSequence(t *testing.T) {
+	codec := NewDefaultCodec()
+	codec.HeaderLayout = NewPacketHeaderLayout(nil, false,
+		PacketHeaderField{Type: PacketHeaderFieldLen, Size: 2},
+		PacketHeaderField{Type: PacketHeaderFieldSequence, Size: 1})
+	config := &ConnectionConfig{SendBufferSize: 1024, RecvBufferSize: 1024, MaxPacketSize: 1024}
+	sender, receiver := newCodecTestConnections(codec, config)
+	// 超过1个字节的序列号回绕
+	for i := 0; i < 300; i++ {
+		codec.Encode(sender, NewDataPacket([]byte("hello")))
+		transferCodecTestData(sender, receiver)
+		if packet, err := codec.Decode(receiver, nil); err != nil || packet == nil {
+			t.Fatalf("i:%v packet:%v err:%v", i, packet, err)
+		}
+	}
+	// 重放上一个数据包
+	codec.Encode(sender, NewDataPacket([]byte("hello")))
+	captured := transferCodecTestData(sender, receiver)
+	if packet, err := codec.Decode(receiver, nil); err != nil || packet == nil {
+		t.Fatalf("packet:%v err:%v", packet, err)
+	}
+	receiver.recvBuffer.Write(captured)
+	if _, err := codec.Decode(receiver, nil); err != ErrPacketHeaderSequence {
+		t.Fatalf("err:%v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package gnet
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+const (
+	// 序列号长度
+	PacketSequenceSize = 4
+	// HMAC校验码长度
+	PacketHmacSize = sha256.Size
+)
+
+// 数据包序列号设置(防重放,防篡改)
+// 开启后,数据包格式: Length|Sequence|Data|HMAC
+// 使用了RingBufferCodec.HeaderLayout时,包头里除了长度之外的字段(如消息号)也在HMAC的校验范围内
+// 每个连接的序列号从1开始,每发一个数据包加1,收包方要求序列号严格连续,重复,乱序,跳号的数据包都会被拒绝
+// 需要配合HmacKey使用,否则序列号可以被伪造
+// 只有TcpConnection支持,TcpConnectionNoRing使用该设置会panic
+type PacketSequenceConfig struct {
+	// HMAC(SHA256)的密钥,校验范围是SessionKey+包头(HeaderLayout,不包含长度字段)+Sequence+Data
+	// 为空则不做HMAC校验
+	HmacKey []byte
+	// 获取连接的会话密钥,会混入HMAC的计算
+	// 每个连接的序列号都从1开始,如果只有固定的HmacKey,截获的数据包可以在新的连接上重放,
+	// 所以每个连接需要一个双方都知道的,不重复的会话密钥(如登录时服务器下发的随机数)
+	// 在收包协程和发包协程里调用,同一个连接需要一直返回相同的值
+	SessionKey func(connection Connection) []byte
+	// 序列号校验失败或HMAC校验失败时的回调
+	// 返回true:丢弃该数据包,连接继续
+	// 返回false:关闭连接
+	// 未设置该回调时,关闭连接
+	OnViolation func(connection Connection, err error, expectSequence, recvSequence uint32) bool
+}
+
+// 连接上的序列号状态
+type packetSequence struct {
+	// 最近发送的序列号
+	sendSequence uint32
+	// 最近收到的序列号
+	recvSequence uint32
+	// 包头里的序列号(PacketHeaderFieldSequence)
+	headerSequence uint32
+	// 最近收到的包头里的序列号
+	recvHeaderSequence uint32
+}
+
+// 序列号和HMAC增加的数据长度
+func (this *PacketSequenceConfig) overhead() int {
+	if len(this.HmacKey) > 0 {
+		return PacketSequenceSize + PacketHmacSize
+	}
+	return PacketSequenceSize
+}
+
+// 编码: 在编码后的数据前面加上序列号,后面加上HMAC
+// headerData:参与HMAC计算的包头数据,不写入编码结果
+func (this *PacketSequenceConfig) encode(connection Connection, sequence *packetSequence, headerData []byte, encodedData [][]byte) [][]byte {
+	sequence.sendSequence++
+	sequenceBytes := make([]byte, PacketSequenceSize)
+	binary.LittleEndian.PutUint32(sequenceBytes, sequence.sendSequence)
+	newEncodedData := make([][]byte, 0, len(encodedData)+2)
+	newEncodedData = append(newEncodedData, sequenceBytes)
+	newEncodedData = append(newEncodedData, encodedData...)
+	if len(this.HmacKey) > 0 {
+		newEncodedData = append(newEncodedData, this.sum(connection, headerData, newEncodedData...))
+	}
+	return newEncodedData
+}
+
+// 解码: 校验HMAC和序列号,返回去掉序列号和HMAC之后的数据
+// headerData:参与HMAC计算的包头数据
+func (this *PacketSequenceConfig) decode(connection Connection, sequence *packetSequence, headerData []byte, packetData []byte) ([]byte, uint32, error) {
+	hmacSize := 0
+	if len(this.HmacKey) > 0 {
+		hmacSize = PacketHmacSize
+	}
+	if len(packetData) < PacketSequenceSize+hmacSize {
+		return nil, 0, ErrPacketLength
+	}
+	recvSequence := binary.LittleEndian.Uint32(packetData)
+	if hmacSize > 0 {
+		dataLen := len(packetData) - hmacSize
+		if !hmac.Equal(this.sum(connection, headerData, packetData[:dataLen]), packetData[dataLen:]) {
+			return nil, recvSequence, ErrPacketHmac
+		}
+	}
+	if recvSequence <= sequence.recvSequence {
+		// 重复或乱序的数据包,可能是重放攻击
+		return nil, recvSequence, ErrPacketSequenceReplay
+	}
+	if recvSequence != sequence.recvSequence+1 {
+		// 跳号
+		return nil, recvSequence, ErrPacketSequenceSkip
+	}
+	sequence.recvSequence = recvSequence
+	return packetData[PacketSequenceSize : len(packetData)-hmacSize], recvSequence, nil
+}
+
+func (this *PacketSequenceConfig) sum(connection Connection, headerData []byte, data ...[]byte) []byte {
+	h := hmac.New(sha256.New, this.HmacKey)
+	// 带上长度,避免会话密钥,包头和后面的数据拼接产生歧义
+	writeWithLen := func(d []byte) {
+		dataLen := make([]byte, 4)
+		binary.LittleEndian.PutUint32(dataLen, uint32(len(d)))
+		h.Write(dataLen)
+		h.Write(d)
+	}
+	if this.SessionKey != nil {
+		writeWithLen(this.SessionKey(connection))
+	}
+	if headerData != nil {
+		writeWithLen(headerData)
+	}
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,140 @@
+package gnet
+
+import (
+	"testing"
+)
+
+// 创建一对只用于编解码测试的连接,不涉及网络
+func newCodecTestConnections(codec Codec, config *ConnectionConfig) (sender, receiver *TcpConnection) {
+	sender = createTcpConnection(config, codec, nil)
+	sender.sendBuffer = sender.createSendBuffer()
+	receiver = createTcpConnection(config, codec, nil)
+	receiver.recvBuffer = receiver.createRecvBuffer()
+	receiver.tmpReadPacketHeaderData = make([]byte, codec.PacketHeaderSize())
+	return
+}
+
+// 把sender的sendBuffer里的数据全部转移到receiver的recvBuffer里
+func transferCodecTestData(sender, receiver *TcpConnection) []byte {
+	data := sender.sendBuffer.ReadFull(sender.sendBuffer.UnReadLength())
+	copyData := make([]byte, len(data))
+	copy(copyData, data)
+	receiver.recvBuffer.Write(copyData)
+	return copyData
+}
+
+func TestPacketSequence(t *testing.T) {
+	var violations []error
+	codec := NewDefaultCodec()
+	codec.Sequence = &PacketSequenceConfig{
+		HmacKey: []byte("sequence_test_key"),
+		OnViolation: func(connection Connection, err error, expectSequence, recvSequence uint32) bool {
+			violations = append(violations, err)
+			return true
+		},
+	}
+	config := &ConnectionConfig{SendBufferSize: 1024, RecvBufferSize: 1024, MaxPacketSize: 512}
+	sender, receiver := newCodecTestConnections(codec, config)
+
+	codec.Encode(sender, NewDataPacket([]byte("buy item")))
+	captured := transferCodecTestData(sender, receiver)
+	packet, err := codec.Decode(receiver, nil)
+	if err != nil || packet == nil || string(packet.GetStreamData()) != "buy item" {
+		t.Fatalf("decode failed packet:%v err:%v", packet, err)
+	}
+
+	// 重放截获的数据包,之后再发一个正常的数据包
+	receiver.recvBuffer.Write(captured)
+	codec.Encode(sender, NewDataPacket([]byte("normal")))
+	transferCodecTestData(sender, receiver)
+	packet, err = codec.Decode(receiver, nil)
+	if err != nil || packet == nil || string(packet.GetStreamData()) != "normal" {
+		t.Fatalf("decode failed packet:%v err:%v", packet, err)
+	}
+	if len(violations) != 1 || violations[0] != ErrPacketSequenceReplay {
+		t.Fatalf("violations:%v", violations)
+	}
+
+	// 篡改序列号
+	codec.Encode(sender, NewDataPacket([]byte("tamper")))
+	tampered := sender.sendBuffer.ReadFull(sender.sendBuffer.UnReadLength())
+	tampered[DefaultPacketHeaderSize] += 1
+	receiver.recvBuffer.Write(tampered)
+	packet, err = codec.Decode(receiver, nil)
+	if packet != nil || len(violations) != 2 || violations[1] != ErrPacketHmac {
+		t.Fatalf("packet:%v violations:%v", packet, violations)
+	}
+
+	// 未设置回调时,返回错误
+	codec.Sequence.OnViolation = nil
+	receiver.recvBuffer.Write(captured)
+	if _, err = codec.Decode(receiver, nil); err != ErrPacketSequenceReplay {
+		t.Fatalf("err:%v", err)
+	}
+}
+
+// 截获的数据包不能在新的连接上重放
+func TestPacketSequenceSessionKey(t *testing.T) {
+	sessionKeyAttr := NewAttr[[]byte]("sessionKey")
+	codec := NewDefaultCodec()
+	codec.Sequence = &PacketSequenceConfig{
+		HmacKey: []byte("sequence_test_key"),
+		SessionKey: func(connection Connection) []byte {
+			return sessionKeyAttr.GetOrZero(connection)
+		},
+	}
+	config := &ConnectionConfig{SendBufferSize: 1024, RecvBufferSize: 1024, MaxPacketSize: 512}
+	sender, receiver := newCodecTestConnections(codec, config)
+	sessionKeyAttr.Set(sender, []byte("session1"))
+	sessionKeyAttr.Set(receiver, []byte("session1"))
+	codec.Encode(sender, NewDataPacket([]byte("buy item")))
+	captured := transferCodecTestData(sender, receiver)
+	if packet, err := codec.Decode(receiver, nil); err != nil || packet == nil {
+		t.Fatalf("decode failed packet:%v err:%v", packet, err)
+	}
+
+	// 新的连接,序列号重新从1开始,但是会话密钥不同
+	_, newReceiver := newCodecTestConnections(codec, config)
+	sessionKeyAttr.Set(newReceiver, []byte("session2"))
+	newReceiver.recvBuffer.Write(captured)
+	if _, err := codec.Decode(newReceiver, nil); err != ErrPacketHmac {
+		t.Fatalf("err:%v", err)
+	}
+}
+
+// TcpConnectionNoRing不支持序列号,不能静默的忽略该设置
+func TestPacketSequenceNoRing(t *testing.T) {
+	codec := NewDefaultCodec()
+	codec.Sequence = &PacketSequenceConfig{HmacKey: []byte("key")}
+	defer func() {
+		if err := recover(); err != ErrSequenceNotSupport {
+			t.Fatalf("err:%v", err)
+		}
+	}()
+	NewTcpConnectionNoRing(&ConnectionConfig{SendPacketCacheCap: 1}, codec, nil)
+}
+
+// 包头里的消息号也在HMAC的校验范围内
+func TestPacketSequenceHeaderLayout(t *testing.T) {
+	codec := NewDefaultCodec()
+	codec.HeaderLayout = NewPacketHeaderLayout(nil, false,
+		PacketHeaderField{Type: PacketHeaderFieldLen, Size: 4},
+		PacketHeaderField{Type: PacketHeaderFieldCommand, Size: 2})
+	codec.Sequence = &PacketSequenceConfig{HmacKey: []byte("sequence_test_key")}
+	config := &ConnectionConfig{SendBufferSize: 1024, RecvBufferSize: 1024, MaxPacketSize: 512}
+	sender, receiver := newCodecTestConnections(codec, config)
+	codec.Encode(sender, NewBigDataPacket(1, []byte("buy item")))
+	transferCodecTestData(sender, receiver)
+	if packet, err := codec.Decode(receiver, nil); err != nil || packet == nil || packet.Command() != 1 {
+		t.Fatalf("decode failed packet:%v err:%v", packet, err)
+	}
+
+	// 篡改包头里的消息号
+	codec.Encode(sender, NewBigDataPacket(1, []byte("buy item")))
+	tampered := sender.sendBuffer.ReadFull(sender.sendBuffer.UnReadLength())
+	tampered[4] = 2
+	receiver.recvBuffer.Write(tampered)
+	if packet, err := codec.Decode(receiver, nil); packet != nil || err != ErrPacketHmac {
+		t.Fatalf("packet:%v err:%v", packet, err)
+	}
+}
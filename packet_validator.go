@@ -0,0 +1,147 @@
+package gnet
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// 消息自带的校验接口
+// 消息实现了Validate() error时,在调用消息回调之前会先调用Validate
+type MessageValidator interface {
+	Validate() error
+}
+
+// 按消息号注册的校验函数
+// 返回error时,该消息不会传给消息回调
+type PacketValidator func(connection Connection, packet *ProtoPacket) error
+
+// 校验失败的回调
+type PacketRejectHandler func(connection Connection, packet *ProtoPacket, err error)
+
+// proto字段约束,对所有消息生效(包括嵌套的消息),0表示不限制
+type MessageConstraints struct {
+	// string字段的最大长度
+	MaxStringLength int
+	// bytes字段的最大长度
+	MaxBytesLength int
+	// repeated和map字段的最大元素个数
+	MaxRepeatedCount int
+}
+
+// 检查消息是否满足字段约束
+func (this *MessageConstraints) Validate(message proto.Message) error {
+	if message == nil {
+		return nil
+	}
+	return this.validateMessage(message.ProtoReflect())
+}
+
+func (this *MessageConstraints) validateMessage(message protoreflect.Message) (err error) {
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		switch {
+		case field.IsList():
+			list := value.List()
+			if this.MaxRepeatedCount > 0 && list.Len() > this.MaxRepeatedCount {
+				err = fmt.Errorf("%w: %v count %v > %v", ErrMessageConstraint, field.FullName(), list.Len(), this.MaxRepeatedCount)
+				return false
+			}
+			for i := 0; i < list.Len(); i++ {
+				if err = this.validateValue(field, list.Get(i)); err != nil {
+					return false
+				}
+			}
+		case field.IsMap():
+			m := value.Map()
+			if this.MaxRepeatedCount > 0 && m.Len() > this.MaxRepeatedCount {
+				err = fmt.Errorf("%w: %v count %v > %v", ErrMessageConstraint, field.FullName(), m.Len(), this.MaxRepeatedCount)
+				return false
+			}
+			m.Range(func(key protoreflect.MapKey, mapValue protoreflect.Value) bool {
+				if err = this.validateValue(field.MapKey(), key.Value()); err != nil {
+					return false
+				}
+				err = this.validateValue(field.MapValue(), mapValue)
+				return err == nil
+			})
+			if err != nil {
+				return false
+			}
+		default:
+			if err = this.validateValue(field, value); err != nil {
+				return false
+			}
+		}
+		return true
+	})
+	return
+}
+
+func (this *MessageConstraints) validateValue(field protoreflect.FieldDescriptor, value protoreflect.Value) error {
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		if this.MaxStringLength > 0 && len(value.String()) > this.MaxStringLength {
+			return fmt.Errorf("%w: %v length %v > %v", ErrMessageConstraint, field.FullName(), len(value.String()), this.MaxStringLength)
+		}
+	case protoreflect.BytesKind:
+		if this.MaxBytesLength > 0 && len(value.Bytes()) > this.MaxBytesLength {
+			return fmt.Errorf("%w: %v length %v > %v", ErrMessageConstraint, field.FullName(), len(value.Bytes()), this.MaxBytesLength)
+		}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return this.validateMessage(value.Message())
+	}
+	return nil
+}
+
+// 消息校验
+// 校验顺序: 字段约束,消息的Validate方法,消息号对应的PacketValidator
+type packetValidation struct {
+	constraints *MessageConstraints
+	validators  map[PacketCommand]PacketValidator
+	onReject    PacketRejectHandler
+	// 每个消息号校验失败的次数 PacketCommand -> *int64
+	rejectCounts sync.Map
+}
+
+func (this *packetValidation) validate(connection Connection, packet *ProtoPacket) error {
+	message := packet.Message()
+	if this.constraints != nil && message != nil {
+		if err := this.constraints.Validate(message); err != nil {
+			return err
+		}
+	}
+	if messageValidator, ok := message.(MessageValidator); ok {
+		if err := messageValidator.Validate(); err != nil {
+			return err
+		}
+	}
+	if validator, ok := this.validators[packet.Command()]; ok && validator != nil {
+		if err := validator(connection, packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *packetValidation) reject(connection Connection, packet *ProtoPacket, err error) {
+	counter, ok := this.rejectCounts.Load(packet.Command())
+	if !ok {
+		counter, _ = this.rejectCounts.LoadOrStore(packet.Command(), new(int64))
+	}
+	atomic.AddInt64(counter.(*int64), 1)
+	if this.onReject != nil {
+		this.onReject(connection, packet, err)
+	} else if connection != nil {
+		logger.Error("%v validate error cmd:%v err:%v", connection.GetConnectionId(), packet.Command(), err)
+	}
+}
+
+func (this *packetValidation) getRejectCount(packetCommand PacketCommand) int64 {
+	if counter, ok := this.rejectCounts.Load(packetCommand); ok {
+		return atomic.LoadInt64(counter.(*int64))
+	}
+	return 0
+}
@@ -0,0 +1,206 @@
+package gnet
+
+import (
+	"sync"
+	"time"
+)
+
+// 超出收包限速时的处理方式
+type RateLimitPolicy uint8
+
+const (
+	// 丢弃数据包
+	RateLimitDrop RateLimitPolicy = iota
+	// 延迟处理数据包(阻塞收包协程,对端的发送也会因为tcp流控而变慢)
+	// 只有连接自己的令牌桶可以预支令牌,Global的令牌桶不足时等待令牌恢复,不会影响其他连接
+	RateLimitDelay
+	// 关闭连接
+	RateLimitClose
+)
+
+// 令牌桶限速设置
+type RateLimit struct {
+	// 每秒产生的令牌数(每秒允许的数据包数)
+	Rate float64
+	// 令牌桶容量(允许的突发数据包数),为0时使用Rate
+	Burst float64
+}
+
+// 收包限速设置
+// 同一个RecvRateLimitConfig的Global限速,由所有使用它的连接共享
+type RecvRateLimitConfig struct {
+	// 所有连接的收包总限速
+	Global *RateLimit
+	// 每个连接的收包限速
+	Connection *RateLimit
+	// 每个连接的消息号限速
+	Commands map[PacketCommand]*RateLimit
+	// 超出限速时的处理方式
+	Policy RateLimitPolicy
+	// 超出限速时的回调,在收包协程中调用
+	OnLimited func(connection Connection, packet Packet, policy RateLimitPolicy)
+
+	globalOnce   sync.Once
+	globalBucket *tokenBucket
+}
+
+func (this *RecvRateLimitConfig) getGlobalBucket() *tokenBucket {
+	this.globalOnce.Do(func() {
+		this.globalBucket = newTokenBucket(this.Global)
+	})
+	return this.globalBucket
+}
+
+// 令牌桶
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rateLimit *RateLimit) *tokenBucket {
+	if rateLimit == nil || rateLimit.Rate <= 0 {
+		return nil
+	}
+	burst := rateLimit.Burst
+	if burst <= 0 {
+		burst = rateLimit.Rate
+	}
+	return &tokenBucket{
+		rate:   rateLimit.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+func (this *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(this.last); elapsed > 0 {
+		this.tokens += elapsed.Seconds() * this.rate
+		if this.tokens > this.burst {
+			this.tokens = this.burst
+		}
+		this.last = now
+	}
+}
+
+// 令牌不足时,返回需要等待的时间
+func (this *tokenBucket) waitTime(count float64) time.Duration {
+	if this.tokens >= count {
+		return 0
+	}
+	return time.Duration((count - this.tokens) / this.rate * float64(time.Second))
+}
+
+// 所有令牌桶都有足够的令牌时,一起消耗令牌,否则都不消耗
+// 检查和消耗在同一次加锁中完成,多个连接共享的令牌桶不会超发
+// 返回需要等待的时间,0表示已经消耗了令牌
+func takeTokens(now time.Time, count float64, buckets ...*tokenBucket) time.Duration {
+	for _, bucket := range buckets {
+		if bucket != nil {
+			bucket.mutex.Lock()
+			defer bucket.mutex.Unlock()
+		}
+	}
+	var wait time.Duration
+	for _, bucket := range buckets {
+		if bucket != nil {
+			bucket.refill(now)
+			if bucketWait := bucket.waitTime(count); bucketWait > wait {
+				wait = bucketWait
+			}
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+	for _, bucket := range buckets {
+		if bucket != nil {
+			bucket.tokens -= count
+		}
+	}
+	return 0
+}
+
+// 消耗令牌,令牌不足时预支,返回需要等待的时间
+func (this *tokenBucket) reserve(now time.Time, count float64) time.Duration {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.refill(now)
+	this.tokens -= count
+	if this.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-this.tokens / this.rate * float64(time.Second))
+}
+
+// 连接的收包限速
+type recvRateLimiter struct {
+	config           *RecvRateLimitConfig
+	connectionBucket *tokenBucket
+	commandBuckets   map[PacketCommand]*tokenBucket
+}
+
+func newRecvRateLimiter(config *RecvRateLimitConfig) *recvRateLimiter {
+	if config == nil {
+		return nil
+	}
+	limiter := &recvRateLimiter{
+		config:           config,
+		connectionBucket: newTokenBucket(config.Connection),
+		commandBuckets:   make(map[PacketCommand]*tokenBucket),
+	}
+	for command, rateLimit := range config.Commands {
+		if bucket := newTokenBucket(rateLimit); bucket != nil {
+			limiter.commandBuckets[command] = bucket
+		}
+	}
+	return limiter
+}
+
+// 检查收包限速,返回false表示该数据包不能交给handler处理
+// 在收包协程中调用,closeNotify:RateLimitDelay等待时,连接关闭则提前返回false
+func (this *recvRateLimiter) allow(connection Connection, packet Packet, closeNotify <-chan struct{}) bool {
+	globalBucket := this.config.getGlobalBucket()
+	commandBucket := this.commandBuckets[packet.Command()]
+	// 全局令牌桶放在第一个,保证多个连接的加锁顺序一致
+	if takeTokens(time.Now(), 1, globalBucket, this.connectionBucket, commandBucket) == 0 {
+		return true
+	}
+	if this.config.OnLimited != nil {
+		this.config.OnLimited(connection, packet, this.config.Policy)
+	}
+	switch this.config.Policy {
+	case RateLimitDrop:
+		return false
+	case RateLimitClose:
+		logger.Debug("%v recv rate limit close cmd:%v", connection.GetConnectionId(), packet.Command())
+		closeWithReason(connection, CloseCodeRateLimit, nil)
+		return false
+	}
+	// RateLimitDelay:连接自己的令牌桶预支令牌,等待的时间只由该连接承担
+	var wait time.Duration
+	now := time.Now()
+	for _, bucket := range [2]*tokenBucket{this.connectionBucket, commandBucket} {
+		if bucket != nil {
+			if bucketWait := bucket.reserve(now, 1); bucketWait > wait {
+				wait = bucketWait
+			}
+		}
+	}
+	if !sleepOrClose(wait, closeNotify) {
+		return false
+	}
+	// 全局令牌桶不预支,等到有令牌时再消耗
+	for {
+		wait = takeTokens(time.Now(), 1, globalBucket)
+		if wait == 0 {
+			return true
+		}
+		if !sleepOrClose(wait, closeNotify) {
+			return false
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package gnet
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRecvRateLimiter(t *testing.T) {
+	limitedCount := 0
+	config := &RecvRateLimitConfig{
+		Global:     &RateLimit{Rate: 1000},
+		Connection: &RateLimit{Rate: 100, Burst: 5},
+		Commands: map[PacketCommand]*RateLimit{
+			1: {Rate: 1, Burst: 2},
+		},
+		Policy: RateLimitDrop,
+		OnLimited: func(connection Connection, packet Packet, policy RateLimitPolicy) {
+			limitedCount++
+		},
+	}
+	connection := newTestConnection(&ConnectionConfig{SendPacketCacheCap: 1, RecvRateLimit: config}, NewProtoCodec(nil), nil)
+	limiter := connection.recvRateLimiter
+	// 消息号1只允许突发2个
+	allowCount := 0
+	for i := 0; i < 4; i++ {
+		if limiter.allow(connection, NewProtoPacket(1, nil), connection.closeNotify) {
+			allowCount++
+		}
+	}
+	if allowCount != 2 || limitedCount != 2 {
+		t.Fatalf("allowCount:%v limitedCount:%v", allowCount, limitedCount)
+	}
+	// 连接总共只允许突发5个
+	allowCount = 0
+	for i := 0; i < 5; i++ {
+		if limiter.allow(connection, NewProtoPacket(2, nil), connection.closeNotify) {
+			allowCount++
+		}
+	}
+	if allowCount != 3 || limitedCount != 4 {
+		t.Fatalf("allowCount:%v limitedCount:%v", allowCount, limitedCount)
+	}
+
+	// 延迟处理
+	config.Policy = RateLimitDelay
+	begin := time.Now()
+	if !limiter.allow(connection, NewProtoPacket(2, nil), connection.closeNotify) {
+		t.Fatal("delay policy not allow")
+	}
+	if cost := time.Since(begin); cost < time.Millisecond*5 {
+		t.Fatalf("delay cost:%v", cost)
+	}
+
+	// 关闭连接
+	config.Policy = RateLimitClose
+	if limiter.allow(connection, NewProtoPacket(1, nil), connection.closeNotify) || connection.IsConnected() {
+		t.Fatal("close policy")
+	}
+}
+
+// 多个连接共享Global限速
+func TestRecvRateLimiterGlobal(t *testing.T) {
+	config := &RecvRateLimitConfig{
+		Global: &RateLimit{Rate: 0.001, Burst: 10},
+		Policy: RateLimitDrop,
+	}
+	// 检查和消耗令牌是原子的,并发时不会超发
+	var allowCount int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			connection := NewTcpConnector(&ConnectionConfig{SendPacketCacheCap: 1, RecvRateLimit: config}, NewProtoCodec(nil), nil)
+			for j := 0; j < 10; j++ {
+				if connection.recvRateLimiter.allow(connection, NewProtoPacket(1, nil), connection.closeNotify) {
+					atomic.AddInt32(&allowCount, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if allowCount != 10 {
+		t.Fatalf("allowCount:%v", allowCount)
+	}
+
+	// 延迟处理时,Global的令牌桶不会被预支,连接关闭时不再等待
+	config.Policy = RateLimitDelay
+	connection := newTestConnection(&ConnectionConfig{SendPacketCacheCap: 1, RecvRateLimit: config}, NewProtoCodec(nil), nil)
+	time.AfterFunc(time.Millisecond*10, func() {
+		connection.Close()
+	})
+	if connection.recvRateLimiter.allow(connection, NewProtoPacket(1, nil), connection.closeNotify) {
+		t.Fatal("delay after close")
+	}
+	if tokens := config.globalBucket.tokens; tokens < 0 {
+		t.Fatalf("global tokens:%v", tokens)
+	}
+}
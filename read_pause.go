@@ -0,0 +1,183 @@
+package gnet
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 自动暂停读取期间,检查上层收包队列长度的默认间隔(毫秒)
+	DefaultReadBackpressureCheckInterval = 10
+)
+
+// 收包背压设置
+// 上层收包队列(如逻辑层的消息队列)的长度达到高水位时,自动暂停读取,
+// 降到低水位及以下时,自动恢复读取
+// 暂停读取期间,数据会堆积在内核的接收缓冲区,由TCP的流量控制让对方减慢发送速度
+type ReadBackpressureConfig struct {
+	// 获取上层收包队列的长度
+	QueueLen func(connection Connection) int
+	// 高水位,为0时不会自动暂停读取
+	HighWaterMark int
+	// 低水位
+	LowWaterMark int
+	// 自动暂停读取期间,检查队列长度的间隔(毫秒),为0时使用DefaultReadBackpressureCheckInterval
+	CheckInterval uint32
+	// 自动暂停读取和自动恢复读取时的回调
+	OnReadPaused func(connection Connection, paused bool)
+}
+
+// 读取暂停控制
+type readPauseControl struct {
+	lock sync.Mutex
+	// 是否暂停读取(手动或自动),用于快速判断
+	paused int32
+	// 手动暂停
+	manualPaused bool
+	// 自动暂停(ReadBackpressureConfig的上层收包队列超过高水位)
+	autoPaused bool
+	// 自动暂停(InboundQueueConfig的收包队列超过高水位)
+	queuePaused bool
+	// 恢复读取时close
+	resumeNotify chan struct{}
+	// 暂停读取的次数
+	pauseCount uint32
+}
+
+// 更新暂停状态,需要在lock内调用
+func (this *readPauseControl) update() {
+	paused := this.manualPaused || this.autoPaused || this.queuePaused
+	if paused {
+		if atomic.SwapInt32(&this.paused, 1) == 0 {
+			this.resumeNotify = make(chan struct{})
+			atomic.AddUint32(&this.pauseCount, 1)
+		}
+	} else {
+		if atomic.SwapInt32(&this.paused, 0) == 1 {
+			close(this.resumeNotify)
+			this.resumeNotify = nil
+		}
+	}
+}
+
+// 暂停读取,已经读取到的数据包会继续交给handler,之后不再从socket读取数据,直到调用ResumeRead
+// NOTE:暂停读取期间不会触发收包超时
+func (this *baseConnection) PauseRead() {
+	this.readPause.lock.Lock()
+	defer this.readPause.lock.Unlock()
+	this.readPause.manualPaused = true
+	this.readPause.update()
+}
+
+// 恢复读取
+// 如果收包队列还在高水位之上(自动暂停),会等到降到低水位才恢复读取
+func (this *baseConnection) ResumeRead() {
+	this.readPause.lock.Lock()
+	defer this.readPause.lock.Unlock()
+	this.readPause.manualPaused = false
+	this.readPause.update()
+}
+
+// 是否暂停读取(手动或自动)
+func (this *baseConnection) IsReadPaused() bool {
+	return atomic.LoadInt32(&this.readPause.paused) == 1
+}
+
+// 暂停读取的次数(手动和自动)
+func (this *baseConnection) GetReadPauseCount() uint32 {
+	return atomic.LoadUint32(&this.readPause.pauseCount)
+}
+
+// 设置自动暂停状态,返回状态是否有变化
+func (this *baseConnection) setAutoReadPaused(paused bool) bool {
+	this.readPause.lock.Lock()
+	defer this.readPause.lock.Unlock()
+	if this.readPause.autoPaused == paused {
+		return false
+	}
+	this.readPause.autoPaused = paused
+	this.readPause.update()
+	return true
+}
+
+// 设置收包队列引起的暂停状态
+func (this *baseConnection) setQueueReadPaused(paused bool) {
+	this.readPause.lock.Lock()
+	defer this.readPause.lock.Unlock()
+	if this.readPause.queuePaused == paused {
+		return
+	}
+	this.readPause.queuePaused = paused
+	this.readPause.update()
+}
+
+// 收包后检查上层收包队列是否达到高水位
+func (this *baseConnection) checkReadBackpressure(connection Connection) {
+	backpressure := this.config.ReadBackpressure
+	if backpressure == nil || backpressure.QueueLen == nil || backpressure.HighWaterMark <= 0 {
+		return
+	}
+	if backpressure.QueueLen(connection) >= backpressure.HighWaterMark {
+		if this.setAutoReadPaused(true) {
+			logger.Debug("%v auto pause read", this.GetConnectionId())
+			if backpressure.OnReadPaused != nil {
+				backpressure.OnReadPaused(connection, true)
+			}
+		}
+	}
+}
+
+// 检查上层收包队列是否降到低水位
+func (this *baseConnection) checkReadBackpressureResume(connection Connection) {
+	backpressure := this.config.ReadBackpressure
+	if backpressure == nil || backpressure.QueueLen == nil {
+		return
+	}
+	if backpressure.QueueLen(connection) <= backpressure.LowWaterMark {
+		if this.setAutoReadPaused(false) {
+			logger.Debug("%v auto resume read", this.GetConnectionId())
+			if backpressure.OnReadPaused != nil {
+				backpressure.OnReadPaused(connection, false)
+			}
+		}
+	}
+}
+
+// 收包协程等待恢复读取,连接关闭时返回false
+func (this *baseConnection) waitReadResume(connection Connection) bool {
+	if !this.IsReadPaused() {
+		return true
+	}
+	logger.Debug("%v read paused", this.GetConnectionId())
+	var checkTicker *time.Ticker
+	var checkChan <-chan time.Time
+	if backpressure := this.config.ReadBackpressure; backpressure != nil && backpressure.QueueLen != nil {
+		checkInterval := backpressure.CheckInterval
+		if checkInterval == 0 {
+			checkInterval = DefaultReadBackpressureCheckInterval
+		}
+		checkTicker = time.NewTicker(time.Millisecond * time.Duration(checkInterval))
+		defer checkTicker.Stop()
+		checkChan = checkTicker.C
+	}
+	for {
+		this.readPause.lock.Lock()
+		resumeNotify := this.readPause.resumeNotify
+		autoPaused := this.readPause.autoPaused
+		this.readPause.lock.Unlock()
+		if resumeNotify == nil {
+			logger.Debug("%v read resumed", this.GetConnectionId())
+			return true
+		}
+		if autoPaused {
+			this.checkReadBackpressureResume(connection)
+		}
+		select {
+		case <-resumeNotify:
+		case <-checkChan:
+		case <-this.closeNotify:
+			return false
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package gnet
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadPause(t *testing.T) {
+	connection := newTestConnection(&ConnectionConfig{SendPacketCacheCap: 1}, NewDefaultCodec(), nil)
+	if !connection.waitReadResume(connection) {
+		t.Fatal("not paused")
+	}
+	connection.PauseRead()
+	connection.PauseRead()
+	if !connection.IsReadPaused() || connection.GetReadPauseCount() != 1 {
+		t.Fatalf("pause failed count:%v", connection.GetReadPauseCount())
+	}
+	resumed := make(chan bool, 1)
+	go func() {
+		resumed <- connection.waitReadResume(connection)
+	}()
+	select {
+	case <-resumed:
+		t.Fatal("resumed while paused")
+	case <-time.After(time.Millisecond * 50):
+	}
+	connection.ResumeRead()
+	select {
+	case ok := <-resumed:
+		if !ok || connection.IsReadPaused() {
+			t.Fatal("resume failed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("resume timeout")
+	}
+
+	// 连接关闭时不再等待
+	connection.PauseRead()
+	go func() {
+		resumed <- connection.waitReadResume(connection)
+	}()
+	connection.Close()
+	select {
+	case ok := <-resumed:
+		if ok {
+			t.Fatal("should return false after close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("close timeout")
+	}
+}
+
+func TestReadBackpressure(t *testing.T) {
+	var queueLen int32
+	var pausedEvents []bool
+	config := &ConnectionConfig{
+		SendPacketCacheCap: 1,
+		ReadBackpressure: &ReadBackpressureConfig{
+			QueueLen: func(connection Connection) int {
+				return int(atomic.LoadInt32(&queueLen))
+			},
+			HighWaterMark: 10,
+			LowWaterMark:  5,
+			CheckInterval: 1,
+			OnReadPaused: func(connection Connection, paused bool) {
+				pausedEvents = append(pausedEvents, paused)
+			},
+		},
+	}
+	connection := newTestConnection(config, NewDefaultCodec(), nil)
+	atomic.StoreInt32(&queueLen, 9)
+	connection.checkReadBackpressure(connection)
+	if connection.IsReadPaused() {
+		t.Fatal("paused below high water mark")
+	}
+	atomic.StoreInt32(&queueLen, 10)
+	connection.checkReadBackpressure(connection)
+	if !connection.IsReadPaused() {
+		t.Fatal("not paused at high water mark")
+	}
+	resumed := make(chan bool, 1)
+	go func() {
+		resumed <- connection.waitReadResume(connection)
+	}()
+	// 高于低水位时保持暂停
+	atomic.StoreInt32(&queueLen, 6)
+	select {
+	case <-resumed:
+		t.Fatal("resumed above low water mark")
+	case <-time.After(time.Millisecond * 50):
+	}
+	atomic.StoreInt32(&queueLen, 5)
+	select {
+	case ok := <-resumed:
+		if !ok || connection.IsReadPaused() {
+			t.Fatal("resume failed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("resume timeout")
+	}
+	if len(pausedEvents) != 2 || !pausedEvents[0] || pausedEvents[1] {
+		t.Fatalf("pausedEvents:%v", pausedEvents)
+	}
+}
@@ -1,5 +1,7 @@
 package gnet
 
+import "bytes"
+
 // 环形buffer,专为TcpConnection定制,在收发包时,可以减少内存分配和拷贝
 // NOTE:不支持多线程,不具备通用性
 type RingBuffer struct {
@@ -57,6 +59,42 @@ func (this *RingBuffer) ReadFull(readLen int) []byte {
 	}
 }
 
+// 查看指定长度的数据,不改变读位置
+// 数据非连续时,拷贝到tmp里,len(tmp)>=peekLen
+func (this *RingBuffer) Peek(peekLen int, tmp []byte) []byte {
+	if this.UnReadLength() < peekLen {
+		return nil
+	}
+	readBuffer := this.ReadBuffer()
+	if len(readBuffer) >= peekLen {
+		// 数据连续,不产生copy
+		return readBuffer[0:peekLen]
+	}
+	// 先拷贝RingBuffer的尾部
+	n := copy(tmp[0:peekLen], readBuffer)
+	// 再拷贝RingBuffer的头部
+	copy(tmp[n:peekLen], this.buffer)
+	return tmp[0:peekLen]
+}
+
+// 在未读取的数据中查找指定字节,返回相对于读位置的偏移,找不到返回-1
+func (this *RingBuffer) IndexByte(c byte) int {
+	if this.UnReadLength() == 0 {
+		return -1
+	}
+	readBuffer := this.ReadBuffer()
+	if index := bytes.IndexByte(readBuffer, c); index >= 0 {
+		return index
+	}
+	if len(readBuffer) < this.UnReadLength() {
+		// 可读部分被分割成尾部和头部两部分,再查找头部
+		if index := bytes.IndexByte(this.buffer[0:this.UnReadLength()-len(readBuffer)], c); index >= 0 {
+			return len(readBuffer) + index
+		}
+	}
+	return -1
+}
+
 //// 读位置
 //func (this *RingBuffer) ReadIndex() int {
 //	return this.r%len(this.buffer)
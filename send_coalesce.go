@@ -0,0 +1,101 @@
+package gnet
+
+import (
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 合并发送(latest-wins)
+// 同一个coalesceKey的数据包,如果旧的数据包还在发包缓存里没有发送,新的数据包会替换旧的数据包,
+// 适用于只关心最新状态的数据包,如血量同步,位置同步
+// 发包缓存里存放的是占位数据包,发包协程取出占位数据包时,再替换成该key最新的数据包
+type sendCoalescer struct {
+	mutex sync.Mutex
+	// 还在发包缓存里的数据包 coalesceKey -> 最新的数据包
+	packets map[uint64]*coalesceEntry
+}
+
+// 合并发送的数据包,每次put都创建新的entry,用来判断是否还是同一次put保存的数据包
+type coalesceEntry struct {
+	packet Packet
+}
+
+// 合并发送的占位数据包
+type coalescePlaceholder struct {
+	coalesceKey uint64
+}
+
+func (this *coalescePlaceholder) Command() PacketCommand {
+	return 0
+}
+
+func (this *coalescePlaceholder) Message() proto.Message {
+	return nil
+}
+
+func (this *coalescePlaceholder) GetStreamData() []byte {
+	return nil
+}
+
+func (this *coalescePlaceholder) Clone() Packet {
+	return &coalescePlaceholder{coalesceKey: this.coalesceKey}
+}
+
+// 保存该key最新的数据包
+// isNew为true表示发包缓存里还没有该key的数据包,需要放入占位数据包
+func (this *sendCoalescer) put(coalesceKey uint64, packet Packet) (entry *coalesceEntry, isNew bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	_, exist := this.packets[coalesceKey]
+	entry = &coalesceEntry{packet: packet}
+	this.packets[coalesceKey] = entry
+	return entry, !exist
+}
+
+// 取出该key最新的数据包
+func (this *sendCoalescer) take(coalesceKey uint64) (packet Packet, ok bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	entry, ok := this.packets[coalesceKey]
+	if !ok {
+		return nil, false
+	}
+	delete(this.packets, coalesceKey)
+	return entry.packet, true
+}
+
+// 该key的数据包还是entry时才删除
+// 其他协程可能已经保存了更新的数据包,不能删除
+func (this *sendCoalescer) remove(coalesceKey uint64, entry *coalesceEntry) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.packets[coalesceKey] == entry {
+		delete(this.packets, coalesceKey)
+	}
+}
+
+// 占位数据包替换成最新的数据包,其他数据包原样返回
+// ok为false表示该占位数据包已经没有对应的数据包
+func (this *sendCoalescer) resolve(packet Packet) (Packet, bool) {
+	if placeholder, isPlaceholder := packet.(*coalescePlaceholder); isPlaceholder {
+		return this.take(placeholder.coalesceKey)
+	}
+	return packet, true
+}
+
+// 合并发送数据包
+// 返回false表示数据包被丢弃或者连接被断开
+func (this *baseConnection) pushCoalescePacket(connection Connection, packet Packet, coalesceKey uint64) bool {
+	entry, isNew := this.sendLanes.coalescer.put(coalesceKey, packet)
+	if !isNew {
+		// 替换了还在发包缓存里的旧数据包
+		return true
+	}
+	if this.pushSendPacket(connection, this.sendLanes.lane(SendPriorityNormal), &coalescePlaceholder{coalesceKey: coalesceKey}) {
+		return true
+	}
+	// 占位数据包没有放入发包缓存,只删除这次保存的数据包
+	this.sendLanes.coalescer.remove(coalesceKey, entry)
+	return false
+}
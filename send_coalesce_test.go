@@ -0,0 +1,64 @@
+package gnet
+
+import (
+	"testing"
+)
+
+func TestSendPacketCoalesce(t *testing.T) {
+	var droppedCommands []PacketCommand
+	connection := newTestConnection(&ConnectionConfig{
+		SendPacketCacheCap: 3,
+		SendOverflowPolicy: SendOverflowDropNewest,
+		OnSendOverflow: func(connection Connection, packet Packet, policy SendOverflowPolicy) {
+			droppedCommands = append(droppedCommands, packet.Command())
+		},
+	}, NewProtoCodec(nil), nil)
+	connection.SendPacketCoalesce(NewProtoPacket(1, nil), 100)
+	connection.SendPacket(NewProtoPacket(2, nil))
+	// 替换还没发送的旧数据包,不占用发包缓存
+	connection.SendPacketCoalesce(NewProtoPacket(3, nil), 100)
+	connection.SendPacketCoalesce(NewProtoPacket(4, nil), 200)
+	if connection.GetSendPacketChanLen() != 3 {
+		t.Fatalf("len:%v", connection.GetSendPacketChanLen())
+	}
+	// 发包缓存满了,新的key被丢弃
+	if connection.SendPacketCoalesce(NewProtoPacket(5, nil), 300) || len(droppedCommands) != 1 || droppedCommands[0] != 5 {
+		t.Fatalf("droppedCommands:%v", droppedCommands)
+	}
+	var commands []PacketCommand
+	for {
+		packet, _, ok := connection.sendLanes.tryPop()
+		if !ok {
+			break
+		}
+		commands = append(commands, packet.Command())
+	}
+	if len(commands) != 3 || commands[0] != 3 || commands[1] != 2 || commands[2] != 4 {
+		t.Fatalf("commands:%v", commands)
+	}
+	// 已经发送的key,再次发送时重新进入发包缓存
+	connection.SendPacketCoalesce(NewProtoPacket(6, nil), 100)
+	connection.SendPacketCoalesce(NewProtoPacket(7, nil), 300)
+	if connection.GetSendPacketChanLen() != 2 {
+		t.Fatalf("len:%v", connection.GetSendPacketChanLen())
+	}
+}
+
+// 占位数据包放入失败时,不能删除其他协程保存的更新的数据包
+func TestSendCoalescerRemove(t *testing.T) {
+	coalescer := &sendCoalescer{packets: make(map[uint64]*coalesceEntry)}
+	entry, isNew := coalescer.put(100, NewProtoPacket(1, nil))
+	if !isNew {
+		t.Fatal("not new")
+	}
+	// 发包缓存满时,占位数据包被丢弃,数据包已经被取出
+	coalescer.take(100)
+	// 其他协程保存了新的数据包,并且放入了自己的占位数据包
+	if _, isNew = coalescer.put(100, NewProtoPacket(2, nil)); !isNew {
+		t.Fatal("not new")
+	}
+	coalescer.remove(100, entry)
+	if packet, ok := coalescer.resolve(&coalescePlaceholder{coalesceKey: 100}); !ok || packet.Command() != 2 {
+		t.Fatalf("packet:%v ok:%v", packet, ok)
+	}
+}
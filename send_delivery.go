@@ -0,0 +1,188 @@
+package gnet
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 发送结果回调
+// err为nil表示数据包已经成功写入socket(conn.Write成功),不代表对方已经收到
+type DeliveryCallback func(err error)
+
+// 带发送结果回调的数据包,只在发包缓存中使用,编码前会取出原始的数据包
+type deliveryPacket struct {
+	// 原始数据包,为nil时表示Flush的标记
+	packet      Packet
+	onDelivered DeliveryCallback
+}
+
+func (this *deliveryPacket) Command() PacketCommand {
+	if this.packet == nil {
+		return 0
+	}
+	return this.packet.Command()
+}
+
+func (this *deliveryPacket) Message() proto.Message {
+	if this.packet == nil {
+		return nil
+	}
+	return this.packet.Message()
+}
+
+func (this *deliveryPacket) GetStreamData() []byte {
+	if this.packet == nil {
+		return nil
+	}
+	return this.packet.GetStreamData()
+}
+
+func (this *deliveryPacket) Clone() Packet {
+	newPacket := &deliveryPacket{onDelivered: this.onDelivered}
+	if this.packet != nil {
+		newPacket.packet = this.packet.Clone()
+	}
+	return newPacket
+}
+
+// 取出原始的数据包
+func unwrapDeliveryPacket(packet Packet) (Packet, DeliveryCallback) {
+	if delivery, ok := packet.(*deliveryPacket); ok {
+		return delivery.packet, delivery.onDelivered
+	}
+	return packet, nil
+}
+
+type pendingDelivery struct {
+	// 该数据包在发送数据流中的结束位置
+	end         uint64
+	onDelivered DeliveryCallback
+}
+
+// 记录发送结果回调,等数据包所在的数据都写入socket之后再回调
+// 只在发包协程中使用
+type sendDeliveryTracker struct {
+	// 编码后的总字节数
+	encodedBytes uint64
+	// 已经写入socket的总字节数
+	writtenBytes uint64
+	// 等待写入socket的回调
+	pending []pendingDelivery
+}
+
+// 编码了n字节
+func (this *sendDeliveryTracker) addEncoded(n int) {
+	this.encodedBytes += uint64(n)
+}
+
+// 在当前编码位置记录一个回调
+func (this *sendDeliveryTracker) track(onDelivered DeliveryCallback) {
+	if onDelivered == nil {
+		return
+	}
+	if this.encodedBytes <= this.writtenBytes {
+		onDelivered(nil)
+		return
+	}
+	this.pending = append(this.pending, pendingDelivery{end: this.encodedBytes, onDelivered: onDelivered})
+}
+
+// 写入socket成功了n字节
+func (this *sendDeliveryTracker) onWritten(n int) {
+	this.writtenBytes += uint64(n)
+	delivered := 0
+	for delivered < len(this.pending) && this.pending[delivered].end <= this.writtenBytes {
+		this.pending[delivered].onDelivered(nil)
+		this.pending[delivered].onDelivered = nil
+		delivered++
+	}
+	if delivered > 0 {
+		this.pending = append(this.pending[:0], this.pending[delivered:]...)
+	}
+}
+
+// 连接关闭时,所有未发送的回调都返回err
+func (this *sendDeliveryTracker) failAll(err error) {
+	for i := range this.pending {
+		this.pending[i].onDelivered(err)
+	}
+	this.pending = nil
+}
+
+// 发包协程结束时,发包缓存里还没发送的数据包的回调都返回ErrConnectionClosed
+func (this *baseConnection) failPendingDeliveries() {
+	this.delivery.failAll(ErrConnectionClosed)
+	this.failQueuedDeliveries()
+}
+
+// 发包缓存里还没发送的数据包的回调都返回ErrConnectionClosed
+// 发包协程结束后到连接关闭之前,仍然可能有数据包放入发包缓存,所以连接关闭时也会调用
+func (this *baseConnection) failQueuedDeliveries() {
+	for _, lane := range this.sendLanes.lanes {
+		for i := len(lane); i > 0; i-- {
+			select {
+			case packet := <-lane:
+				if _, onDelivered := unwrapDeliveryPacket(packet); onDelivered != nil {
+					onDelivered(ErrConnectionClosed)
+				}
+			default:
+			}
+		}
+	}
+}
+
+// 异步发送数据,数据包写入socket成功或失败后回调onDelivered
+// onDelivered一般在发包协程中调用,发包缓存满而被丢弃时在调用者的协程中调用
+func (this *baseConnection) pushDeliveryPacket(connection Connection, packet Packet, priority SendPriority, onDelivered DeliveryCallback) bool {
+	if !this.canSend() {
+		if onDelivered != nil {
+			onDelivered(ErrConnectionClosed)
+		}
+		return false
+	}
+	if !this.pushSendPacket(connection, this.sendLanes.lane(priority), &deliveryPacket{packet: packet, onDelivered: onDelivered}) {
+		return false
+	}
+	select {
+	case <-this.closeNotify:
+		// 放入发包缓存时连接已经关闭,发包协程和Close可能都不会再处理该数据包
+		this.failQueuedDeliveries()
+	default:
+	}
+	return true
+}
+
+// 等待发包缓存里的数据包(包括各个优先级)和发送缓存里的数据都写入socket
+// 在每个优先级的发包缓存里放入一个标记,所有标记之前的数据都写入socket之后返回
+// 等待期间连接关闭时返回ErrConnectionClosed,发包协程结束后发包缓存里的标记不会再有回调
+func (this *baseConnection) flush(ctx context.Context) error {
+	if !this.IsConnected() {
+		return ErrConnectionClosed
+	}
+	results := make(chan error, SendPriorityCount)
+	for _, lane := range this.sendLanes.lanes {
+		select {
+		case lane <- &deliveryPacket{onDelivered: func(err error) {
+			results <- err
+		}}:
+		case <-this.closeNotify:
+			return ErrConnectionClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	for i := 0; i < int(SendPriorityCount); i++ {
+		select {
+		case err := <-results:
+			if err != nil {
+				return err
+			}
+		case <-this.closeNotify:
+			return ErrConnectionClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package gnet
+
+import (
+	"testing"
+)
+
+// 发包协程已经结束,连接还没关闭时放入发包缓存的数据包,连接关闭时回调ErrConnectionClosed
+func TestSendDeliveryAfterWriteLoop(t *testing.T) {
+	var results []error
+	onDelivered := func(err error) {
+		results = append(results, err)
+	}
+	connection := newTestConnection(&ConnectionConfig{SendPacketCacheCap: 4}, NewProtoCodec(nil), nil)
+	if !connection.SendPacketWithCallback(NewProtoPacket(1, nil), SendPriorityNormal, onDelivered) {
+		t.Fatal("send failed")
+	}
+	connection.Close()
+	if len(results) != 1 || results[0] != ErrConnectionClosed {
+		t.Fatalf("results:%v", results)
+	}
+
+	noRingConnection := NewTcpConnectionNoRing(&ConnectionConfig{SendPacketCacheCap: 4}, NewProtoCodec(nil), nil)
+	noRingConnection.state = int32(ConnectionStateConnected)
+	if !noRingConnection.SendPacketWithCallback(NewProtoPacket(1, nil), SendPriorityHigh, onDelivered) {
+		t.Fatal("send failed")
+	}
+	noRingConnection.Close()
+	if len(results) != 2 || results[1] != ErrConnectionClosed {
+		t.Fatalf("results:%v", results)
+	}
+	// 连接关闭后不会再重复回调
+	if connection.SendPacketWithCallback(NewProtoPacket(1, nil), SendPriorityNormal, onDelivered) || len(results) != 3 {
+		t.Fatalf("results:%v", results)
+	}
+}
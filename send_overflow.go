@@ -0,0 +1,157 @@
+package gnet
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 发包缓存(sendPacketCache)满时的处理方式
+type SendOverflowPolicy uint8
+
+const (
+	// 阻塞,直到发包缓存有空位(默认)
+	SendOverflowBlock SendOverflowPolicy = iota
+	// 阻塞,超时后丢弃新的数据包
+	SendOverflowBlockTimeout
+	// 丢弃新的数据包
+	SendOverflowDropNewest
+	// 丢弃发包缓存里最早的数据包,Flush的标记不会被丢弃
+	// SendPacketCacheCap为0时,没有可以丢弃的数据包,按SendOverflowDropNewest处理
+	SendOverflowDropOldest
+	// 断开连接(发包太慢的连接)
+	SendOverflowDisconnect
+)
+
+// 发包缓存满时,丢弃数据包或断开连接的回调
+// packet:被丢弃的数据包,断开连接时是新的数据包
+type SendOverflowHandler func(connection Connection, packet Packet, policy SendOverflowPolicy)
+
+// 数据包放入发包缓存,发包缓存满时,按照ConnectionConfig.SendOverflowPolicy处理
+// 返回false表示新的数据包被丢弃或者连接被断开
+func (this *baseConnection) pushSendPacket(connection Connection, sendPacketCache chan Packet, packet Packet) bool {
+	policy := this.config.SendOverflowPolicy
+	if policy == SendOverflowBlock {
+		// NOTE:当sendPacketCache满时,这里会阻塞,直到有空位或者连接关闭
+		select {
+		case sendPacketCache <- packet:
+			return true
+		case <-this.closeNotify:
+			return false
+		}
+	}
+	// 非阻塞方式写chan
+	select {
+	case sendPacketCache <- packet:
+		return true
+	default:
+	}
+	switch policy {
+	case SendOverflowBlockTimeout:
+		sendTimeout := time.NewTimer(time.Millisecond * time.Duration(this.config.SendOverflowTimeout))
+		defer sendTimeout.Stop()
+		select {
+		case sendPacketCache <- packet:
+			return true
+		case <-sendTimeout.C:
+		}
+	case SendOverflowDropOldest:
+		if cap(sendPacketCache) == 0 {
+			// 没有缓存的数据包可以丢弃,避免在发包协程阻塞期间空转
+			break
+		}
+		return this.pushDropOldest(connection, sendPacketCache, packet)
+	case SendOverflowDisconnect:
+		logger.Debug("%v send overflow disconnect", this.GetConnectionId())
+		this.onSendOverflow(connection, packet, policy)
+		closeWithReason(connection, CloseCodeSendOverflow, ErrSendOverflow)
+		return false
+	}
+	this.onSendOverflow(connection, packet, policy)
+	return false
+}
+
+// 丢弃发包缓存里最早的数据包,直到新的数据包放入发包缓存
+func (this *baseConnection) pushDropOldest(connection Connection, sendPacketCache chan Packet, packet Packet) bool {
+	// 取出的Flush的标记
+	var flushMarkers []Packet
+	for {
+		select {
+		case oldPacket := <-sendPacketCache:
+			if isFlushMarker(oldPacket) {
+				// Flush的标记不是调用者发送的数据包,不丢弃,放入新的数据包之后再放回发包缓存
+				// 标记放到后面只会让Flush多等待一些数据,不影响Flush的正确性
+				flushMarkers = append(flushMarkers, oldPacket)
+			} else {
+				// 发包协程可能同时在读取,所以取出的也可能不是最早的那个
+				this.onSendOverflow(connection, oldPacket, SendOverflowDropOldest)
+			}
+		default:
+		}
+		if len(flushMarkers) >= cap(sendPacketCache) {
+			// 发包缓存放不下新的数据包和Flush的标记,丢弃新的数据包
+			this.pushFlushMarkers(sendPacketCache, flushMarkers)
+			this.onSendOverflow(connection, packet, SendOverflowDropOldest)
+			return false
+		}
+		// 空位足够放入新的数据包和Flush的标记时才写入,否则继续丢弃
+		if cap(sendPacketCache)-len(sendPacketCache) > len(flushMarkers) {
+			select {
+			case sendPacketCache <- packet:
+				this.pushFlushMarkers(sendPacketCache, flushMarkers)
+				return true
+			default:
+			}
+		}
+	}
+}
+
+// 把取出的Flush的标记放回发包缓存
+// 已经预留了空位,只有其他协程同时发包时才会等待,连接关闭时Flush会返回ErrConnectionClosed
+func (this *baseConnection) pushFlushMarkers(sendPacketCache chan Packet, flushMarkers []Packet) {
+	for _, flushMarker := range flushMarkers {
+		select {
+		case sendPacketCache <- flushMarker:
+		case <-this.closeNotify:
+		}
+	}
+}
+
+// Flush的标记
+func isFlushMarker(packet Packet) bool {
+	delivery, ok := packet.(*deliveryPacket)
+	return ok && delivery.packet == nil
+}
+
+func (this *baseConnection) onSendOverflow(connection Connection, packet Packet, policy SendOverflowPolicy) {
+	// 丢弃的是合并发送的占位数据包时,回调该key最新的数据包
+	if resolvedPacket, ok := this.sendLanes.coalescer.resolve(packet); ok {
+		packet = resolvedPacket
+	}
+	packet, onDelivered := unwrapDeliveryPacket(packet)
+	if onDelivered != nil {
+		onDelivered(ErrSendOverflow)
+	}
+	if packet == nil {
+		// Flush的标记
+		return
+	}
+	atomic.AddUint32(&this.sendOverflowCount, 1)
+	atomic.AddUint64(&sendOverflowTotalCount, 1)
+	if this.config.OnSendOverflow != nil {
+		this.config.OnSendOverflow(connection, packet, policy)
+	}
+}
+
+// 该连接因为发包缓存满而丢弃数据包或断开连接的次数
+func (this *baseConnection) GetSendOverflowCount() uint32 {
+	return atomic.LoadUint32(&this.sendOverflowCount)
+}
+
+var (
+	sendOverflowTotalCount uint64 = 0
+)
+
+// 所有连接因为发包缓存满而丢弃数据包或断开连接的总次数
+func GetSendOverflowTotalCount() uint64 {
+	return atomic.LoadUint64(&sendOverflowTotalCount)
+}
@@ -0,0 +1,116 @@
+package gnet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendOverflowPolicy(t *testing.T) {
+	var droppedCommands []PacketCommand
+	newConnection := func(policy SendOverflowPolicy) *TcpConnection {
+		return newTestConnection(&ConnectionConfig{
+			SendPacketCacheCap:  2,
+			SendOverflowPolicy:  policy,
+			SendOverflowTimeout: 10,
+			OnSendOverflow: func(connection Connection, packet Packet, policy SendOverflowPolicy) {
+				droppedCommands = append(droppedCommands, packet.Command())
+			},
+		}, NewProtoCodec(nil), nil)
+	}
+	sendPackets := func(connection *TcpConnection) (sendCount int) {
+		for i := 1; i <= 3; i++ {
+			if connection.SendPacket(NewProtoPacket(PacketCommand(i), nil)) {
+				sendCount++
+			}
+		}
+		return
+	}
+
+	// 丢弃新的数据包
+	connection := newConnection(SendOverflowDropNewest)
+	if sendCount := sendPackets(connection); sendCount != 2 || len(droppedCommands) != 1 || droppedCommands[0] != 3 {
+		t.Fatalf("sendCount:%v droppedCommands:%v", sendCount, droppedCommands)
+	}
+
+	// 超时丢弃新的数据包
+	droppedCommands = nil
+	connection = newConnection(SendOverflowBlockTimeout)
+	begin := time.Now()
+	if sendCount := sendPackets(connection); sendCount != 2 || len(droppedCommands) != 1 || time.Since(begin) < time.Millisecond*10 {
+		t.Fatalf("sendCount:%v droppedCommands:%v", sendCount, droppedCommands)
+	}
+
+	// 丢弃最早的数据包
+	droppedCommands = nil
+	connection = newConnection(SendOverflowDropOldest)
+	if sendCount := sendPackets(connection); sendCount != 3 || len(droppedCommands) != 1 || droppedCommands[0] != 1 {
+		t.Fatalf("sendCount:%v droppedCommands:%v", sendCount, droppedCommands)
+	}
+	if packet := <-connection.sendPacketCache; packet.Command() != 2 {
+		t.Fatalf("packet:%v", packet.Command())
+	}
+
+	// 断开连接
+	droppedCommands = nil
+	connection = newConnection(SendOverflowDisconnect)
+	if sendCount := sendPackets(connection); sendCount != 2 || connection.IsConnected() || connection.GetSendOverflowCount() != 1 {
+		t.Fatalf("sendCount:%v droppedCommands:%v", sendCount, droppedCommands)
+	}
+	if GetSendOverflowTotalCount() < 4 {
+		t.Fatalf("total:%v", GetSendOverflowTotalCount())
+	}
+}
+
+// 丢弃最早的数据包时,不丢弃Flush的标记,没有发包缓存时按丢弃新的数据包处理
+func TestSendOverflowDropOldestFlushMarker(t *testing.T) {
+	var droppedCommands []PacketCommand
+	newConnection := func(sendPacketCacheCap uint32) *TcpConnection {
+		return newTestConnection(&ConnectionConfig{
+			SendPacketCacheCap: sendPacketCacheCap,
+			SendOverflowPolicy: SendOverflowDropOldest,
+			OnSendOverflow: func(connection Connection, packet Packet, policy SendOverflowPolicy) {
+				droppedCommands = append(droppedCommands, packet.Command())
+			},
+		}, NewProtoCodec(nil), nil)
+	}
+	connection := newConnection(2)
+	var flushErr error
+	connection.sendPacketCache <- &deliveryPacket{onDelivered: func(err error) {
+		flushErr = err
+	}}
+	for i := 1; i <= 3; i++ {
+		if !connection.SendPacket(NewProtoPacket(PacketCommand(i), nil)) {
+			t.Fatalf("send %v failed", i)
+		}
+	}
+	if flushErr != nil || len(droppedCommands) != 2 || droppedCommands[0] != 1 || droppedCommands[1] != 2 {
+		t.Fatalf("flushErr:%v droppedCommands:%v", flushErr, droppedCommands)
+	}
+	// 标记放回到发包缓存里
+	if packet := <-connection.sendPacketCache; !isFlushMarker(packet) {
+		t.Fatalf("packet:%v", packet)
+	}
+	if packet := <-connection.sendPacketCache; packet.Command() != 3 {
+		t.Fatalf("packet:%v", packet.Command())
+	}
+
+	// 发包缓存只能放下Flush的标记时,丢弃新的数据包
+	droppedCommands = nil
+	connection = newConnection(1)
+	connection.sendPacketCache <- &deliveryPacket{onDelivered: func(err error) {
+		flushErr = err
+	}}
+	if connection.SendPacket(NewProtoPacket(1, nil)) || flushErr != nil || len(droppedCommands) != 1 || droppedCommands[0] != 1 {
+		t.Fatalf("flushErr:%v droppedCommands:%v", flushErr, droppedCommands)
+	}
+	if packet := <-connection.sendPacketCache; !isFlushMarker(packet) {
+		t.Fatalf("packet:%v", packet)
+	}
+
+	// 没有发包缓存时不会空转
+	droppedCommands = nil
+	connection = newConnection(0)
+	if connection.SendPacket(NewProtoPacket(1, nil)) || len(droppedCommands) != 1 || droppedCommands[0] != 1 {
+		t.Fatalf("droppedCommands:%v", droppedCommands)
+	}
+}
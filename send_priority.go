@@ -0,0 +1,110 @@
+package gnet
+
+// 发包优先级
+type SendPriority uint8
+
+const (
+	// 高优先级,如心跳包,踢人通知,战斗消息
+	SendPriorityHigh SendPriority = iota
+	// 普通优先级,Send和SendPacket使用该优先级
+	SendPriorityNormal
+	// 低优先级,如背包同步等大量的数据
+	SendPriorityLow
+	// 优先级数量
+	SendPriorityCount
+)
+
+// 默认的防饿死设置:低优先级的数据包最多被跳过的次数
+const DefaultSendPriorityStarveLimit = 16
+
+// 多个优先级的发包缓存
+// 发包协程优先发送高优先级的数据包,低优先级的数据包被跳过一定次数后,会优先发送一次,防止低优先级的数据包一直发不出去
+type sendPriorityLanes struct {
+	// 每个优先级的发包缓存chan,SendPriorityNormal就是连接的sendPacketCache
+	lanes [SendPriorityCount]chan Packet
+	// 每个优先级被跳过的次数
+	starves [SendPriorityCount]uint32
+	// 被跳过多少次之后,优先发送一次
+	starveLimit uint32
+	// 合并发送的数据包
+	coalescer sendCoalescer
+}
+
+// 每个优先级的容量都是SendPacketCacheCap,SendPriorityNormal和只有一个发包缓存时的行为保持一致
+func (this *sendPriorityLanes) init(config *ConnectionConfig) {
+	for i := range this.lanes {
+		this.lanes[i] = make(chan Packet, config.SendPacketCacheCap)
+	}
+	this.coalescer.packets = make(map[uint64]*coalesceEntry)
+	this.starveLimit = config.SendPriorityStarveLimit
+	if this.starveLimit == 0 {
+		this.starveLimit = DefaultSendPriorityStarveLimit
+	}
+}
+
+// 发包缓存chan
+func (this *sendPriorityLanes) lane(priority SendPriority) chan Packet {
+	if priority >= SendPriorityCount {
+		priority = SendPriorityLow
+	}
+	return this.lanes[priority]
+}
+
+// 所有优先级的数据包数量
+func (this *sendPriorityLanes) len() int {
+	count := 0
+	for _, lane := range this.lanes {
+		count += len(lane)
+	}
+	return count
+}
+
+// 从某个优先级取出了一个数据包,更新其他优先级被跳过的次数
+// 在发包协程中调用
+func (this *sendPriorityLanes) onPop(priority SendPriority) {
+	this.starves[priority] = 0
+	for i := priority + 1; i < SendPriorityCount; i++ {
+		if len(this.lanes[i]) > 0 {
+			this.starves[i]++
+		}
+	}
+}
+
+// 按优先级取出一个数据包,不阻塞,ok为false表示没有数据包
+// 合并发送的占位数据包会替换成最新的数据包
+// 在发包协程中调用
+func (this *sendPriorityLanes) tryPop() (packet Packet, priority SendPriority, ok bool) {
+	for {
+		if packet, priority, ok = this.tryPopLane(); !ok {
+			return nil, priority, false
+		}
+		if packet, ok = this.coalescer.resolve(packet); ok {
+			return packet, priority, true
+		}
+	}
+}
+
+func (this *sendPriorityLanes) tryPopLane() (packet Packet, priority SendPriority, ok bool) {
+	// 防饿死:被跳过太多次的低优先级,先取一个
+	for i := SendPriorityCount - 1; i > SendPriorityHigh; i-- {
+		if this.starves[i] < this.starveLimit {
+			continue
+		}
+		select {
+		case packet = <-this.lanes[i]:
+			this.onPop(i)
+			return packet, i, true
+		default:
+			this.starves[i] = 0
+		}
+	}
+	for i := SendPriorityHigh; i < SendPriorityCount; i++ {
+		select {
+		case packet = <-this.lanes[i]:
+			this.onPop(i)
+			return packet, i, true
+		default:
+		}
+	}
+	return nil, SendPriorityLow, false
+}
@@ -0,0 +1,38 @@
+package gnet
+
+import (
+	"testing"
+)
+
+func TestSendPriorityLanes(t *testing.T) {
+	connection := newTestConnection(&ConnectionConfig{
+		SendPacketCacheCap:      10,
+		SendPriorityStarveLimit: 2,
+	}, NewProtoCodec(nil), nil)
+	for i := 0; i < 5; i++ {
+		connection.SendPacketWithPriority(NewProtoPacket(PacketCommand(100+i), nil), SendPriorityHigh)
+	}
+	connection.SendPacket(NewProtoPacket(200, nil))
+	connection.SendPacketWithPriority(NewProtoPacket(300, nil), SendPriorityLow)
+	if connection.GetSendPacketChanLen() != 7 {
+		t.Fatalf("len:%v", connection.GetSendPacketChanLen())
+	}
+	var commands []PacketCommand
+	for {
+		packet, _, ok := connection.sendLanes.tryPop()
+		if !ok {
+			break
+		}
+		commands = append(commands, packet.Command())
+	}
+	// 普通和低优先级的数据包被跳过2次后,各优先发送一次
+	expectCommands := []PacketCommand{100, 101, 300, 200, 102, 103, 104}
+	if len(commands) != len(expectCommands) {
+		t.Fatalf("commands:%v", commands)
+	}
+	for i := range commands {
+		if commands[i] != expectCommands[i] {
+			t.Fatalf("commands:%v", commands)
+		}
+	}
+}
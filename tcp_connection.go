@@ -2,6 +2,7 @@ package gnet
 
 import (
 	"context"
+	"fmt"
 	"google.golang.org/protobuf/proto"
 	"io"
 	"net"
@@ -28,6 +29,12 @@ type TcpConnection struct {
 	tmpReadPacketHeader PacketHeader
 	tmpReadPacketHeaderData []byte
 	curReadPacketHeader PacketHeader
+	// 正在接收的大包(超出RingBuffer大小的数据包或分片重组的数据包)
+	bigPacketData []byte
+	// 当前分片已接收的长度
+	bigPacketFrameRead int
+	// 分片发送的大包写不下sendBuffer的分片数据,引用的是数据包的数据,不产生copy
+	delaySendFragments net.Buffers
 	//// 外部传进来的WaitGroup
 	//netMgrWg *sync.WaitGroup
 }
@@ -36,9 +43,6 @@ func NewTcpConnector(config *ConnectionConfig, codec Codec, handler ConnectionHa
 	if config.MaxPacketSize == 0 {
 		config.MaxPacketSize = MaxPacketDataSize
 	}
-	if config.MaxPacketSize > MaxPacketDataSize {
-		config.MaxPacketSize = MaxPacketDataSize
-	}
 	newConnection := createTcpConnection(config, codec, handler)
 	newConnection.isConnector = true
 	return newConnection
@@ -48,12 +52,10 @@ func NewTcpConnectionAccept(conn net.Conn, config *ConnectionConfig, codec Codec
 	if config.MaxPacketSize == 0 {
 		config.MaxPacketSize = MaxPacketDataSize
 	}
-	if config.MaxPacketSize > MaxPacketDataSize {
-		config.MaxPacketSize = MaxPacketDataSize
-	}
 	newConnection := createTcpConnection(config, codec, handler)
 	newConnection.isConnector = false
-	newConnection.isConnected = true
+	// accept的连接创建时就是已连接状态,不发送状态变化事件
+	newConnection.initState(ConnectionStateConnected)
 	newConnection.conn = conn
 	return newConnection
 }
@@ -65,9 +67,15 @@ func createTcpConnection(config *ConnectionConfig, codec Codec, handler Connecti
 			config: config,
 			codec: codec,
 			handler: handler,
+			closeNotify: make(chan struct{}),
+			recvRateLimiter: newRecvRateLimiter(config.RecvRateLimit),
+			sendLimiter: newSendBandwidthLimiter(config.SendBandwidth),
+			inboundQueue: newInboundQueue(config.InboundQueue),
 		},
-		sendPacketCache:     make(chan Packet, config.SendPacketCacheCap),
 	}
+	newConnection.ctx = newConnectionContext(newConnection)
+	newConnection.sendLanes.init(config)
+	newConnection.sendPacketCache = newConnection.sendLanes.lane(SendPriorityNormal)
 	newConnection.tmpReadPacketHeader = codec.CreatePacketHeader(newConnection, nil, nil)
 	return newConnection
 }
@@ -76,15 +84,16 @@ func createTcpConnection(config *ConnectionConfig, codec Codec, handler Connecti
 func (this *TcpConnection) Connect(address string) bool {
 	conn, err := net.DialTimeout("tcp", address, time.Second)
 	if err != nil {
-		this.isConnected = false
 		logger.Error("Connect failed %v: %v", this.GetConnectionId(), err.Error())
+		this.setCloseReason(CloseCodeConnectFailed, err)
+		this.setState(this, ConnectionStateClosed)
 		if this.handler != nil {
 			this.handler.OnConnected(this,false)
 		}
 		return false
 	}
 	this.conn = conn
-	this.isConnected = true
+	this.setState(this, ConnectionStateConnected)
 	if this.handler != nil {
 		this.handler.OnConnected(this,true)
 	}
@@ -94,19 +103,23 @@ func (this *TcpConnection) Connect(address string) bool {
 // 开启读写协程
 func (this *TcpConnection) Start(ctx context.Context, netMgrWg *sync.WaitGroup, onClose func(connection Connection)) {
 	this.onClose = onClose
+	this.ctx.setParent(ctx)
 	// 开启收包协程
 	netMgrWg.Add(1)
 	go func() {
 		defer func() {
 			netMgrWg.Done()
 			if err := recover(); err != nil {
-				logger.Error("read fatal %v: %v", this.GetConnectionId(), err.(error))
+				logger.Error("read fatal %v: %v", this.GetConnectionId(), err)
 				LogStack()
 			}
 		}()
 		this.readLoop()
+		this.stopInboundDelivery()
 		this.Close()
 	}()
+	// 开启收包队列的投递协程
+	this.startInboundDelivery(this, ctx, netMgrWg)
 
 	// 开启发包协程
 	netMgrWg.Add(1)
@@ -114,7 +127,7 @@ func (this *TcpConnection) Start(ctx context.Context, netMgrWg *sync.WaitGroup,
 		defer func() {
 			netMgrWg.Done()
 			if err := recover(); err != nil {
-				logger.Error("write fatal %v: %v", this.GetConnectionId(), err.(error))
+				logger.Error("write fatal %v: %v", this.GetConnectionId(), err)
 				LogStack()
 			}
 		}()
@@ -127,7 +140,8 @@ func (this *TcpConnection) Start(ctx context.Context, netMgrWg *sync.WaitGroup,
 func (this *TcpConnection) readLoop() {
 	defer func() {
 		if err := recover(); err != nil {
-			logger.Error("readLoop fatal %v: %v", this.GetConnectionId(), err.(error))
+			logger.Error("readLoop fatal %v: %v", this.GetConnectionId(), err)
+			this.setCloseReason(CloseCodeReadError, fmt.Errorf("readLoop fatal: %v", err))
 			LogStack()
 		}
 	}()
@@ -135,27 +149,40 @@ func (this *TcpConnection) readLoop() {
 	logger.Debug("readLoop begin %v", this.GetConnectionId())
 	this.recvBuffer = this.createRecvBuffer()
 	this.tmpReadPacketHeaderData = make([]byte,this.codec.PacketHeaderSize())
-	for this.isConnected {
+	for this.IsConnected() {
+		if !this.waitReadResumeAndRefresh() {
+			break
+		}
 		// 可写入的连续buffer
 		writeBuffer := this.recvBuffer.WriteBuffer()
 		if len(writeBuffer) == 0 {
 			// 不会运行到这里来,除非recvBuffer的大小设置太小:小于了包头的长度
 			logger.Error("%v recvBuffer full", this.GetConnectionId())
+			this.setCloseReason(CloseCodeReadError, ErrBufferFull)
 			return
 		}
 		n,err := this.conn.Read(writeBuffer)
 		if err != nil {
 			if err != io.EOF {
 				logger.Debug("readLoop %v err:%v", this.GetConnectionId(), err.Error())
+				this.setCloseReason(CloseCodeReadError, err)
+			} else {
+				this.setCloseReason(CloseCodePeerEOF, err)
+				this.onPeerEOF()
 			}
 			break
 		}
 		//LogDebug("%v Read:%v", this.GetConnectionId(), n)
 		this.recvBuffer.SetWrited(n)
-		for this.isConnected {
+		for this.IsConnected() {
+			// 暂停读取时,已经读取到RingBuffer里的数据包也暂停交给handler
+			if !this.waitReadResumeAndRefresh() {
+				return
+			}
 			newPacket,decodeError := this.codec.Decode(this, this.recvBuffer.ReadBuffer())
 			if decodeError != nil {
 				logger.Error("%v decodeError:%v", this.GetConnectionId(), decodeError.Error())
+				this.setCloseReason(CloseCodeDecodeError, decodeError)
 				return
 			}
 			if newPacket == nil {
@@ -164,9 +191,14 @@ func (this *TcpConnection) readLoop() {
 			// 最近收到完整数据包的时间
 			// 有一种极端情况,网速太慢,即使没有掉线,也可能触发收包超时检测
 			this.lastRecvPacketTick = GetCurrentTimeStamp()
-			if this.handler != nil {
-				this.handler.OnRecvPacket(this, newPacket)
+			// 收包限速,超出限速的数据包不会交给handler
+			if this.recvRateLimiter != nil && !this.recvRateLimiter.allow(this, newPacket, this.closeNotify) {
+				continue
 			}
+			if !this.recvPacket(this, newPacket) {
+				return
+			}
+			this.checkReadBackpressure(this)
 		}
 	}
 	logger.Debug("readLoop end %v", this.GetConnectionId())
@@ -176,9 +208,11 @@ func (this *TcpConnection) readLoop() {
 func (this *TcpConnection) writeLoop(ctx context.Context) {
 	defer func() {
 		if err := recover(); err != nil {
-			logger.Error("writeLoop fatal %v: %v", this.GetConnectionId(), err.(error))
+			logger.Error("writeLoop fatal %v: %v", this.GetConnectionId(), err)
+			this.setCloseReason(CloseCodeWriteError, fmt.Errorf("writeLoop fatal: %v", err))
 			//LogStack()
 		}
+		this.failPendingDeliveries()
 		logger.Debug("writeLoop end %v", this.GetConnectionId())
 	}()
 
@@ -190,101 +224,105 @@ func (this *TcpConnection) writeLoop(ctx context.Context) {
 	heartBeatTimer := time.NewTimer(time.Second * time.Duration(this.config.HeartBeatInterval))
 	defer heartBeatTimer.Stop()
 	this.sendBuffer = this.createSendBuffer()
-	for this.isConnected {
-		var delaySendDecodePacketData []byte
+	for this.IsConnected() {
+		var delaySendDecodePacketData net.Buffers
+		var encodeOk bool
+		// select在多个case就绪时随机选择,所以先不阻塞地尝试高优先级的发包缓存,保证高优先级的数据包不会排在这一批的后面
 		select {
-		case packet := <-this.sendPacketCache:
-			if packet == nil {
-				logger.Debug("packet==nil %v", this.GetConnectionId())
+		case packet := <-this.sendLanes.lanes[SendPriorityHigh]:
+			if delaySendDecodePacketData,encodeOk = this.encodeSendPackets(packet, SendPriorityHigh); !encodeOk {
 				return
 			}
-			// 数据包编码
-			// Encode里面会把编码后的数据直接写入sendBuffer
-			delaySendDecodePacketData = this.codec.Encode(this, packet)
-			if len(delaySendDecodePacketData) > 0 {
-				// Encode里面写不完的数据延后处理
-				logger.Debug("%v sendBuffer is full delaySize:%v", this.GetConnectionId(), len(delaySendDecodePacketData))
-				break
-			}
-			packetCount := len(this.sendPacketCache)
-			// 还有其他数据包在chan里,就进行批量合并
-			if packetCount > 0 {
-				for i := 0; i < packetCount; i++ {
-					// 这里不会阻塞
-					newPacket,ok := <-this.sendPacketCache
-					if !ok {
-						logger.Debug("newPacket==nil %v", this.GetConnectionId())
-						return
-					}
-					// 数据包编码
-					delaySendDecodePacketData = this.codec.Encode(this, newPacket)
-					if len(delaySendDecodePacketData) > 0 {
-						logger.Debug("%v sendBuffer is full delaySize:%v", this.GetConnectionId(), len(delaySendDecodePacketData))
-						break
-					}
+		default:
+			select {
+			case packet := <-this.sendLanes.lanes[SendPriorityHigh]:
+				if delaySendDecodePacketData,encodeOk = this.encodeSendPackets(packet, SendPriorityHigh); !encodeOk {
+					return
 				}
-			}
-			//LogDebug("%v packetCount:%v unReadLen:%v", this.GetConnectionId(), packetCount+1, sendBuffer.UnReadLength())
-
-		case <-recvTimeoutTimer.C:
-			if this.config.RecvTimeout > 0 {
-				nextTimeoutTime := this.config.RecvTimeout + this.lastRecvPacketTick - GetCurrentTimeStamp()
-				if nextTimeoutTime > 0 {
-					recvTimeoutTimer.Reset(time.Second * time.Duration(nextTimeoutTime))
-				} else {
-					// 指定时间内,一直未读取到数据包,则认为该连接掉线了,可能处于"假死"状态了
-					// 需要主动关闭该连接,防止连接"泄漏"
-					logger.Debug("recv timeout %v", this.GetConnectionId())
+			case packet := <-this.sendLanes.lanes[SendPriorityNormal]:
+				if delaySendDecodePacketData,encodeOk = this.encodeSendPackets(packet, SendPriorityNormal); !encodeOk {
 					return
 				}
-			}
+			case packet := <-this.sendLanes.lanes[SendPriorityLow]:
+				if delaySendDecodePacketData,encodeOk = this.encodeSendPackets(packet, SendPriorityLow); !encodeOk {
+					return
+				}
+
+			case <-recvTimeoutTimer.C:
+				if this.config.RecvTimeout > 0 && this.IsReadPaused() {
+					// 暂停读取期间不检测收包超时
+					recvTimeoutTimer.Reset(time.Second * time.Duration(this.config.RecvTimeout))
+				} else if this.config.RecvTimeout > 0 {
+					nextTimeoutTime := this.config.RecvTimeout + this.lastRecvPacketTick - GetCurrentTimeStamp()
+					if nextTimeoutTime > 0 {
+						recvTimeoutTimer.Reset(time.Second * time.Duration(nextTimeoutTime))
+					} else {
+						// 指定时间内,一直未读取到数据包,则认为该连接掉线了,可能处于"假死"状态了
+						// 需要主动关闭该连接,防止连接"泄漏"
+						logger.Debug("recv timeout %v", this.GetConnectionId())
+						this.setCloseReason(CloseCodeRecvTimeout, nil)
+						return
+					}
+				}
 
-		case <-heartBeatTimer.C:
-			if this.isConnector && this.config.HeartBeatInterval > 0 && this.handler != nil {
-				if heartBeatPacket := this.handler.CreateHeartBeatPacket(this); heartBeatPacket != nil {
-					delaySendDecodePacketData = this.codec.Encode(this, heartBeatPacket)
-					heartBeatTimer.Reset(time.Second * time.Duration(this.config.HeartBeatInterval))
+			case <-heartBeatTimer.C:
+				// 优雅关闭时已经关闭了写端,不再发送心跳包
+				if this.isConnector && this.config.HeartBeatInterval > 0 && this.handler != nil && !this.IsClosingGracefully() {
+					if heartBeatPacket := this.handler.CreateHeartBeatPacket(this); heartBeatPacket != nil {
+						// 心跳包按照高优先级处理,不受发包限速
+						delaySendDecodePacketData = this.encodePacket(heartBeatPacket, SendPriorityHigh)
+						heartBeatTimer.Reset(time.Second * time.Duration(this.config.HeartBeatInterval))
+					}
 				}
-			}
 
-		case <-ctx.Done():
-			// 收到外部的关闭通知
-			logger.Debug("recv closeNotify %v", this.GetConnectionId())
-			return
+			case <-ctx.Done():
+				// 收到外部的关闭通知
+				logger.Debug("recv closeNotify %v", this.GetConnectionId())
+				this.setCloseReason(CloseCodeShutdown, ctx.Err())
+				return
+			}
 		}
 
 		if this.sendBuffer.UnReadLength() > 0 {
 			// 可读数据有可能分别存在数组的尾部和头部,所以需要循环发送,有可能需要发送多次
-			for this.isConnected && this.sendBuffer.UnReadLength() > 0 {
+			for this.IsConnected() && this.sendBuffer.UnReadLength() > 0 {
+				readBuffer := this.sendBuffer.ReadBuffer()
+				// 发包限速,不受限速的数据直接写入
+				if this.sendLimiter != nil {
+					writeSize,bypass := this.sendLimiter.nextWrite(len(readBuffer))
+					readBuffer = readBuffer[:writeSize]
+					if !bypass && !this.sendLimiter.wait(writeSize, this.closeNotify) {
+						return
+					}
+				}
 				if this.config.WriteTimeout > 0 {
 					setTimeoutErr := this.conn.SetWriteDeadline(time.Now().Add(time.Duration(this.config.WriteTimeout)*time.Second))
 					// Q:什么情况会导致SetWriteDeadline返回err?
 					if setTimeoutErr != nil {
 						// ...
 						logger.Debug("%v setTimeoutErr:%v", this.GetConnectionId(), setTimeoutErr.Error())
+						this.setCloseReason(CloseCodeWriteError, setTimeoutErr)
 						return
 					}
 				}
-				readBuffer := this.sendBuffer.ReadBuffer()
 				//LogDebug("readBuffer:%v", readBuffer)
 				//LogDebug("%v readBuffer:%v", this.GetConnectionId(), len(readBuffer))
 				writeCount, err := this.conn.Write(readBuffer)
 				if err != nil {
 					// ...
 					logger.Debug("%v write Err:%v", this.GetConnectionId(), err.Error())
+					this.setCloseReason(CloseCodeWriteError, err)
 					return
 				}
 				this.sendBuffer.SetReaded(writeCount)
+				this.delivery.onWritten(writeCount)
+				if this.sendLimiter != nil {
+					this.sendLimiter.onWritten(writeCount)
+				}
 				//LogDebug("%v send:%v unread:%v", this.GetConnectionId(), writeCount, sendBuffer.UnReadLength())
 				if len(delaySendDecodePacketData) > 0 {
-					writedLen,_ := this.sendBuffer.Write(delaySendDecodePacketData)
 					// 这里不一定能全部写完
-					if writedLen < len(delaySendDecodePacketData) {
-						delaySendDecodePacketData = delaySendDecodePacketData[writedLen:]
-						logger.Debug("%v write delaybuffer :%v", this.GetConnectionId(), writedLen)
-					} else {
-						delaySendDecodePacketData = nil
-					}
+					delaySendDecodePacketData = writeDelaySendData(this.sendBuffer, delaySendDecodePacketData)
 				}
 				//LogDebug("%v write count:%v unread:%v", this.GetConnectionId(), writeCount, sendBuffer.UnReadLength())
 			}
@@ -292,17 +330,113 @@ func (this *TcpConnection) writeLoop(ctx context.Context) {
 	}
 }
 
+// 按优先级批量编码发包缓存里的数据包,直到sendBuffer写满
+// packet:唤醒发包协程的数据包,priority:该数据包的优先级
+// 返回写不下的数据,ok为false表示需要结束发包协程
+func (this *TcpConnection) encodeSendPackets(packet Packet, priority SendPriority) (delaySendDecodePacketData net.Buffers, ok bool) {
+	if packet == nil {
+		logger.Debug("packet==nil %v", this.GetConnectionId())
+		return nil, false
+	}
+	this.sendLanes.onPop(priority)
+	// 合并发送的占位数据包替换成最新的数据包
+	if resolvedPacket,hasPacket := this.sendLanes.coalescer.resolve(packet); hasPacket {
+		// 数据包编码
+		// Encode里面会把编码后的数据直接写入sendBuffer
+		delaySendDecodePacketData = this.encodePacket(resolvedPacket, priority)
+		if len(delaySendDecodePacketData) > 0 {
+			// Encode里面写不完的数据延后处理
+			logger.Debug("%v sendBuffer is full delaySize:%v", this.GetConnectionId(), buffersLen(delaySendDecodePacketData))
+			return delaySendDecodePacketData, true
+		}
+	}
+	// 还有其他数据包在chan里,就按优先级进行批量合并
+	packetCount := this.sendLanes.len()
+	for i := 0; i < packetCount; i++ {
+		// 受限速的数据已经攒够一次写入的数据量,剩下的数据包留给下一批,让不受限速的数据包有机会先发送
+		if this.sendLimiter != nil && this.sendLimiter.isBatchFull() {
+			break
+		}
+		// 这里不会阻塞
+		newPacket,newPriority,hasPacket := this.sendLanes.tryPop()
+		if !hasPacket {
+			break
+		}
+		if newPacket == nil {
+			logger.Debug("newPacket==nil %v", this.GetConnectionId())
+			return nil, false
+		}
+		// 数据包编码
+		delaySendDecodePacketData = this.encodePacket(newPacket, newPriority)
+		if len(delaySendDecodePacketData) > 0 {
+			logger.Debug("%v sendBuffer is full delaySize:%v", this.GetConnectionId(), buffersLen(delaySendDecodePacketData))
+			break
+		}
+	}
+	return delaySendDecodePacketData, true
+}
+
+// 数据包编码,编码后的数据写入sendBuffer,返回写不下的数据
+// priority:数据包的优先级,用于判断是否受发包限速
+func (this *TcpConnection) encodePacket(packet Packet, priority SendPriority) net.Buffers {
+	packet, onDelivered := unwrapDeliveryPacket(packet)
+	var delaySendDecodePacketData net.Buffers
+	if packet != nil {
+		unReadLength := this.sendBuffer.UnReadLength()
+		if delayData := this.codec.Encode(this, packet); len(delayData) > 0 {
+			delaySendDecodePacketData = net.Buffers{delayData}
+		} else if len(this.delaySendFragments) > 0 {
+			// 分片发送的大包,写不下的分片数据
+			delaySendDecodePacketData = this.delaySendFragments
+			this.delaySendFragments = nil
+		}
+		encodedLen := this.sendBuffer.UnReadLength() - unReadLength + buffersLen(delaySendDecodePacketData)
+		this.delivery.addEncoded(encodedLen)
+		if this.sendLimiter != nil {
+			this.sendLimiter.addEncoded(encodedLen, this.sendLimiter.isBypass(packet, priority))
+		}
+	}
+	// 数据包之前的数据都写入socket之后回调
+	this.delivery.track(onDelivered)
+	return delaySendDecodePacketData
+}
+
+// 把写不下的数据写入sendBuffer,返回仍然写不下的数据
+func writeDelaySendData(sendBuffer *RingBuffer, delayData net.Buffers) net.Buffers {
+	for len(delayData) > 0 {
+		writedLen,_ := sendBuffer.Write(delayData[0])
+		if writedLen < len(delayData[0]) {
+			delayData[0] = delayData[0][writedLen:]
+			return delayData
+		}
+		delayData = delayData[1:]
+	}
+	return nil
+}
+
+// 优雅关闭:不再接受新的发包,等待已有的数据发送完,关闭写端,等待对方关闭连接或者超时
+// 异步执行,关闭完成后会调用OnDisconnected
+func (this *TcpConnection) CloseGracefully(timeout time.Duration) {
+	this.closeGracefully(this, this.conn, timeout)
+}
+
 // 关闭
 func (this *TcpConnection) Close() {
 	this.closeOnce.Do(func() {
-		this.isConnected = false
+		// 没有记录关闭原因时,就是本地调用的Close
+		this.setCloseReason(CloseCodeLocal, nil)
+		this.setState(this, ConnectionStateClosed)
+		this.ctx.cancel()
+		close(this.closeNotify)
+		// 发包协程可能已经结束,发包缓存里剩余的数据包的回调返回ErrConnectionClosed
+		this.failQueuedDeliveries()
 		if this.conn != nil {
 			this.conn.Close()
 			logger.Debug("close %v", this.GetConnectionId())
 			//this.conn = nil
 		}
 		if this.handler != nil {
-			this.handler.OnDisconnected(this)
+			this.handler.OnDisconnected(this, this.GetCloseReason())
 		}
 		if this.onClose != nil {
 			this.onClose(this)
@@ -313,29 +447,62 @@ func (this *TcpConnection) Close() {
 // 异步发送proto包
 // NOTE:调用Send(command,message)之后,不要再对message进行读写!
 func (this *TcpConnection) Send(command PacketCommand, message proto.Message) bool {
-	if !this.isConnected {
+	if !this.canSend() {
 		return false
 	}
 	packet := NewProtoPacket(command, message)
-	// NOTE:当sendPacketCache满时,这里会阻塞
-	this.sendPacketCache <- packet
-	return true
+	// NOTE:当sendPacketCache满时,按照ConnectionConfig.SendOverflowPolicy处理,默认阻塞
+	return this.pushSendPacket(this, this.sendPacketCache, packet)
 }
 
 // 异步发送数据
 // NOTE:调用SendPacket(packet)之后,不要再对packet进行读写!
 func (this *TcpConnection) SendPacket(packet Packet) bool {
-	if !this.isConnected {
+	if !this.canSend() {
 		return false
 	}
-	// NOTE:当sendPacketCache满时,这里会阻塞
-	this.sendPacketCache <- packet
-	return true
+	// NOTE:当sendPacketCache满时,按照ConnectionConfig.SendOverflowPolicy处理,默认阻塞
+	return this.pushSendPacket(this, this.sendPacketCache, packet)
+}
+
+// 按优先级异步发送数据,高优先级的数据包优先发送
+// NOTE:调用SendPacketWithPriority(packet,priority)之后,不要再对packet进行读写!
+func (this *TcpConnection) SendPacketWithPriority(packet Packet, priority SendPriority) bool {
+	if !this.canSend() {
+		return false
+	}
+	// NOTE:当发包缓存满时,按照ConnectionConfig.SendOverflowPolicy处理,默认阻塞
+	return this.pushSendPacket(this, this.sendLanes.lane(priority), packet)
+}
+
+// 合并发送,同一个coalesceKey的数据包还在发包缓存里没有发送时,新的数据包会替换旧的数据包
+// NOTE:调用SendPacketCoalesce(packet,coalesceKey)之后,不要再对packet进行读写!
+func (this *TcpConnection) SendPacketCoalesce(packet Packet, coalesceKey uint64) bool {
+	if !this.canSend() {
+		return false
+	}
+	return this.pushCoalescePacket(this, packet, coalesceKey)
+}
+
+// 异步发送数据,数据包写入socket成功或失败后回调onDelivered
+// onDelivered一般在发包协程中调用
+// NOTE:调用SendPacketWithCallback(packet,priority,onDelivered)之后,不要再对packet进行读写!
+func (this *TcpConnection) SendPacketWithCallback(packet Packet, priority SendPriority, onDelivered DeliveryCallback) bool {
+	return this.pushDeliveryPacket(this, packet, priority, onDelivered)
+}
+
+// 等待发包缓存和发送缓存里的数据都写入socket
+// 如:发送踢人通知之后,等通知发出去再关闭连接
+func (this *TcpConnection) Flush(ctx context.Context) error {
+	return this.flush(ctx)
 }
 
 // 超时发包,超时未发送则丢弃,适用于某些允许丢弃的数据包
 // 可以防止某些"不重要的"数据包造成chan阻塞,比如游戏项目常见的聊天广播
 func (this *TcpConnection) TrySendPacket(packet Packet, timeout time.Duration) bool {
+	if !this.canSend() {
+		return false
+	}
 	if timeout == 0 {
 		// 非阻塞方式写chan
 		select {
@@ -354,7 +521,6 @@ func (this *TcpConnection) TrySendPacket(packet Packet, timeout time.Duration) b
 			return false
 		}
 	}
-	return false
 }
 
 // 创建用于批量发包的RingBuffer
@@ -362,7 +528,7 @@ func (this *TcpConnection) createSendBuffer() *RingBuffer {
 	ringBufferSize := this.config.SendBufferSize
 	if ringBufferSize == 0 {
 		if this.config.MaxPacketSize > 0 {
-			ringBufferSize = this.config.MaxPacketSize*2
+			ringBufferSize = defaultRingBufferSize(this.config.MaxPacketSize)
 		} else {
 			ringBufferSize = 65535
 		}
@@ -375,7 +541,7 @@ func (this *TcpConnection) createRecvBuffer() *RingBuffer {
 	ringBufferSize := this.config.RecvBufferSize
 	if ringBufferSize == 0 {
 		if this.config.MaxPacketSize > 0 {
-			ringBufferSize = this.config.MaxPacketSize*2
+			ringBufferSize = defaultRingBufferSize(this.config.MaxPacketSize)
 		} else {
 			ringBufferSize = 65535
 		}
@@ -383,6 +549,15 @@ func (this *TcpConnection) createRecvBuffer() *RingBuffer {
 	return NewRingBuffer(int(ringBufferSize))
 }
 
+// 根据MaxPacketSize计算默认的RingBuffer大小
+// 超过MaxPacketDataSize的大包会分片收发,所以RingBuffer不需要超过MaxPacketDataSize*2
+func defaultRingBufferSize(maxPacketSize uint32) uint32 {
+	if maxPacketSize > MaxPacketDataSize {
+		maxPacketSize = MaxPacketDataSize
+	}
+	return maxPacketSize*2
+}
+
 // 发包RingBuffer
 func (this *TcpConnection) GetSendBuffer() *RingBuffer {
 	return this.sendBuffer
@@ -410,5 +585,17 @@ func (this *TcpConnection) RemoteAddr() net.Addr {
 }
 
 func (this *TcpConnection) GetSendPacketChanLen() int {
-	return len(this.sendPacketCache)
+	return this.sendLanes.len()
+}
+
+// 等待恢复读取,恢复后重新计算收包超时
+func (this *TcpConnection) waitReadResumeAndRefresh() bool {
+	if !this.IsReadPaused() {
+		return true
+	}
+	if !this.waitReadResume(this) {
+		return false
+	}
+	this.lastRecvPacketTick = GetCurrentTimeStamp()
+	return true
 }
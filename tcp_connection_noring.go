@@ -2,6 +2,7 @@ package gnet
 
 import (
 	"context"
+	"fmt"
 	"google.golang.org/protobuf/proto"
 	"io"
 	"net"
@@ -9,6 +10,11 @@ import (
 	"time"
 )
 
+const (
+	// TcpConnectionNoRing单次写入socket的最大字节数
+	NoRingWriteChunkSize = 256*1024
+)
+
 // 不使用RingBuffer的TcpConnection
 // 也支持BigPacketHeader
 type TcpConnectionNoRing struct {
@@ -45,21 +51,32 @@ func NewTcpConnectionNoRingAccept(conn net.Conn, config *ConnectionConfig, codec
 	}
 	newConnection := createTcpConnectionNoRing(config, codec, handler)
 	newConnection.isConnector = false
-	newConnection.isConnected = true
+	// accept的连接创建时就是已连接状态,不发送状态变化事件
+	newConnection.initState(ConnectionStateConnected)
 	newConnection.conn = conn
 	return newConnection
 }
 
 func createTcpConnectionNoRing(config *ConnectionConfig, codec Codec, handler ConnectionHandler) *TcpConnectionNoRing {
+	// 序列号只在TcpConnection的RingBufferCodec里实现,不能静默的忽略该设置
+	if sequenceCodec,ok := codec.(sequenceCodec); ok && sequenceCodec.sequenceConfig() != nil {
+		panic(ErrSequenceNotSupport)
+	}
 	newConnection := &TcpConnectionNoRing{
 		baseConnection: baseConnection{
 			connectionId: newConnectionId(),
 			config: config,
 			codec: codec,
 			handler: handler,
+			closeNotify: make(chan struct{}),
+			recvRateLimiter: newRecvRateLimiter(config.RecvRateLimit),
+			sendLimiter: newSendBandwidthLimiter(config.SendBandwidth),
+			inboundQueue: newInboundQueue(config.InboundQueue),
 		},
-		sendPacketCache:     make(chan Packet, config.SendPacketCacheCap),
 	}
+	newConnection.ctx = newConnectionContext(newConnection)
+	newConnection.sendLanes.init(config)
+	newConnection.sendPacketCache = newConnection.sendLanes.lane(SendPriorityNormal)
 	return newConnection
 }
 
@@ -67,15 +84,16 @@ func createTcpConnectionNoRing(config *ConnectionConfig, codec Codec, handler Co
 func (this *TcpConnectionNoRing) Connect(address string) bool {
 	conn, err := net.DialTimeout("tcp", address, time.Second)
 	if err != nil {
-		this.isConnected = false
 		logger.Error("Connect failed %v: %v", this.GetConnectionId(), err.Error())
+		this.setCloseReason(CloseCodeConnectFailed, err)
+		this.setState(this, ConnectionStateClosed)
 		if this.handler != nil {
 			this.handler.OnConnected(this,false)
 		}
 		return false
 	}
 	this.conn = conn
-	this.isConnected = true
+	this.setState(this, ConnectionStateConnected)
 	if this.handler != nil {
 		this.handler.OnConnected(this,true)
 	}
@@ -85,19 +103,23 @@ func (this *TcpConnectionNoRing) Connect(address string) bool {
 // 开启读写协程
 func (this *TcpConnectionNoRing) Start(ctx context.Context, netMgrWg *sync.WaitGroup, onClose func(connection Connection)) {
 	this.onClose = onClose
+	this.ctx.setParent(ctx)
 	// 开启收包协程
 	netMgrWg.Add(1)
 	go func() {
 		defer func() {
 			netMgrWg.Done()
 			if err := recover(); err != nil {
-				logger.Error("read fatal %v: %v", this.GetConnectionId(), err.(error))
+				logger.Error("read fatal %v: %v", this.GetConnectionId(), err)
 				LogStack()
 			}
 		}()
 		this.readLoop()
+		this.stopInboundDelivery()
 		this.Close()
 	}()
+	// 开启收包队列的投递协程
+	this.startInboundDelivery(this, ctx, netMgrWg)
 
 	// 开启发包协程
 	netMgrWg.Add(1)
@@ -105,7 +127,7 @@ func (this *TcpConnectionNoRing) Start(ctx context.Context, netMgrWg *sync.WaitG
 		defer func() {
 			netMgrWg.Done()
 			if err := recover(); err != nil {
-				logger.Error("write fatal %v: %v", this.GetConnectionId(), err.(error))
+				logger.Error("write fatal %v: %v", this.GetConnectionId(), err)
 				LogStack()
 			}
 		}()
@@ -118,19 +140,27 @@ func (this *TcpConnectionNoRing) Start(ctx context.Context, netMgrWg *sync.WaitG
 func (this *TcpConnectionNoRing) readLoop() {
 	defer func() {
 		if err := recover(); err != nil {
-			logger.Error("readLoop fatal %v: %v", this.GetConnectionId(), err.(error))
+			logger.Error("readLoop fatal %v: %v", this.GetConnectionId(), err)
+			this.setCloseReason(CloseCodeReadError, fmt.Errorf("readLoop fatal: %v", err))
 			LogStack()
 		}
 	}()
 
 	logger.Debug("readLoop begin %v", this.GetConnectionId())
-	for this.isConnected {
+	for this.IsConnected() {
+		if !this.waitReadResumeAndRefresh() {
+			break
+		}
 		// 先读取消息头
 		messageHeaderData := make([]byte, this.codec.PacketHeaderSize())
 		readHeaderSize,err := io.ReadFull(this.conn, messageHeaderData)
 		if err != nil {
 			if err != io.EOF {
 				logger.Debug("readLoop %v err:%v", this.GetConnectionId(), err.Error())
+				this.setCloseReason(CloseCodeReadError, err)
+			} else {
+				this.setCloseReason(CloseCodePeerEOF, err)
+				this.onPeerEOF()
 			}
 			break
 		}
@@ -148,6 +178,10 @@ func (this *TcpConnectionNoRing) readLoop() {
 			if err != nil {
 				if err != io.EOF {
 					logger.Debug("readLoop %v err:%v", this.GetConnectionId(), err.Error())
+					this.setCloseReason(CloseCodeReadError, err)
+				} else {
+					this.setCloseReason(CloseCodePeerEOF, err)
+					this.onPeerEOF()
 				}
 				break
 			}
@@ -158,6 +192,7 @@ func (this *TcpConnectionNoRing) readLoop() {
 		newPacket,decodeError := this.codec.Decode(this, fullPacketData)
 		if decodeError != nil {
 			logger.Error("%v decodeError:%v", this.GetConnectionId(), decodeError.Error())
+			this.setCloseReason(CloseCodeDecodeError, decodeError)
 			return
 		}
 		if newPacket == nil {
@@ -165,9 +200,14 @@ func (this *TcpConnectionNoRing) readLoop() {
 		}
 		// 最近收到完整数据包的时间
 		this.lastRecvPacketTick = GetCurrentTimeStamp()
-		if this.handler != nil {
-			this.handler.OnRecvPacket(this, newPacket)
+		// 收包限速,超出限速的数据包不会交给handler
+		if this.recvRateLimiter != nil && !this.recvRateLimiter.allow(this, newPacket, this.closeNotify) {
+			continue
 		}
+		if !this.recvPacket(this, newPacket) {
+			return
+		}
+		this.checkReadBackpressure(this)
 	}
 	logger.Debug("readLoop end %v", this.GetConnectionId())
 }
@@ -176,9 +216,11 @@ func (this *TcpConnectionNoRing) readLoop() {
 func (this *TcpConnectionNoRing) writeLoop(ctx context.Context) {
 	defer func() {
 		if err := recover(); err != nil {
-			logger.Error("writeLoop fatal %v: %v", this.GetConnectionId(), err.(error))
+			logger.Error("writeLoop fatal %v: %v", this.GetConnectionId(), err)
+			this.setCloseReason(CloseCodeWriteError, fmt.Errorf("writeLoop fatal: %v", err))
 			//LogStack()
 		}
+		this.failPendingDeliveries()
 		logger.Debug("writeLoop end %v", this.GetConnectionId())
 	}()
 
@@ -189,108 +231,306 @@ func (this *TcpConnectionNoRing) writeLoop(ctx context.Context) {
 	// 心跳包计时
 	heartBeatTimer := time.NewTimer(time.Second * time.Duration(this.config.HeartBeatInterval))
 	defer heartBeatTimer.Stop()
-	for this.isConnected {
+	// 批量发送的数据包
+	packets := make([]Packet, 0, cap(this.sendPacketCache)*int(SendPriorityCount)+1)
+	// 批量发送的数据包的优先级
+	priorities := make([]SendPriority, 0, cap(packets))
+	for this.IsConnected() {
+		var collectOk, writeOk bool
+		// select在多个case就绪时随机选择,所以先不阻塞地尝试高优先级的发包缓存,保证高优先级的数据包不会排在这一批的后面
 		select {
-		case packet := <-this.sendPacketCache:
-			if packet == nil {
-				logger.Debug("packet==nil %v", this.GetConnectionId())
-				return
-			}
-			if !this.writePacket(packet) {
+		case packet := <-this.sendLanes.lanes[SendPriorityHigh]:
+			if packets,priorities,collectOk = this.collectSendPackets(packets, priorities, packet, SendPriorityHigh); !collectOk {
 				return
 			}
-
-		case <-recvTimeoutTimer.C:
-			if this.config.RecvTimeout > 0 {
-				nextTimeoutTime := this.config.RecvTimeout + this.lastRecvPacketTick - GetCurrentTimeStamp()
-				if nextTimeoutTime > 0 {
-					recvTimeoutTimer.Reset(time.Second * time.Duration(nextTimeoutTime))
-				} else {
-					// 指定时间内,一直未读取到数据包,则认为该连接掉线了,可能处于"假死"状态了
-					// 需要主动关闭该连接,防止连接"泄漏"
-					logger.Debug("recv timeout %v", this.GetConnectionId())
+			writeOk = this.writePackets(packets, priorities)
+		default:
+			select {
+			case packet := <-this.sendLanes.lanes[SendPriorityHigh]:
+				if packets,priorities,collectOk = this.collectSendPackets(packets, priorities, packet, SendPriorityHigh); !collectOk {
 					return
 				}
-			}
+				writeOk = this.writePackets(packets, priorities)
+			case packet := <-this.sendLanes.lanes[SendPriorityNormal]:
+				if packets,priorities,collectOk = this.collectSendPackets(packets, priorities, packet, SendPriorityNormal); !collectOk {
+					return
+				}
+				writeOk = this.writePackets(packets, priorities)
+			case packet := <-this.sendLanes.lanes[SendPriorityLow]:
+				if packets,priorities,collectOk = this.collectSendPackets(packets, priorities, packet, SendPriorityLow); !collectOk {
+					return
+				}
+				writeOk = this.writePackets(packets, priorities)
 
-		case <-heartBeatTimer.C:
-			if this.isConnector && this.config.HeartBeatInterval > 0 && this.handler != nil {
-				if heartBeatPacket := this.handler.CreateHeartBeatPacket(this); heartBeatPacket != nil {
-					if !this.writePacket(heartBeatPacket) {
+			case <-recvTimeoutTimer.C:
+				if this.config.RecvTimeout > 0 && this.IsReadPaused() {
+					// 暂停读取期间不检测收包超时
+					recvTimeoutTimer.Reset(time.Second * time.Duration(this.config.RecvTimeout))
+				} else if this.config.RecvTimeout > 0 {
+					nextTimeoutTime := this.config.RecvTimeout + this.lastRecvPacketTick - GetCurrentTimeStamp()
+					if nextTimeoutTime > 0 {
+						recvTimeoutTimer.Reset(time.Second * time.Duration(nextTimeoutTime))
+					} else {
+						// 指定时间内,一直未读取到数据包,则认为该连接掉线了,可能处于"假死"状态了
+						// 需要主动关闭该连接,防止连接"泄漏"
+						logger.Debug("recv timeout %v", this.GetConnectionId())
+						this.setCloseReason(CloseCodeRecvTimeout, nil)
 						return
 					}
-					heartBeatTimer.Reset(time.Second * time.Duration(this.config.HeartBeatInterval))
 				}
+
+			case <-heartBeatTimer.C:
+				// 优雅关闭时已经关闭了写端,不再发送心跳包
+				if this.isConnector && this.config.HeartBeatInterval > 0 && this.handler != nil && !this.IsClosingGracefully() {
+					if heartBeatPacket := this.handler.CreateHeartBeatPacket(this); heartBeatPacket != nil {
+						// 心跳包按照高优先级处理,不受发包限速
+						if !this.writePackets([]Packet{heartBeatPacket}, []SendPriority{SendPriorityHigh}) {
+							return
+						}
+						heartBeatTimer.Reset(time.Second * time.Duration(this.config.HeartBeatInterval))
+					}
+				}
+
+			case <-ctx.Done():
+				// 收到外部的关闭通知
+				logger.Debug("recv closeNotify %v", this.GetConnectionId())
+				this.setCloseReason(CloseCodeShutdown, ctx.Err())
+				return
+			}
+		}
+		if len(packets) > 0 {
+			// 释放引用
+			for i := range packets {
+				packets[i] = nil
 			}
+			packets = packets[:0]
+			priorities = priorities[:0]
+			if !writeOk {
+				return
+			}
+		}
+	}
+}
 
-		case <-ctx.Done():
-			// 收到外部的关闭通知
-			logger.Debug("recv closeNotify %v", this.GetConnectionId())
-			return
+// 按优先级取出发包缓存里的数据包
+// packet:唤醒发包协程的数据包,priority:该数据包的优先级
+// ok为false表示需要结束发包协程
+func (this *TcpConnectionNoRing) collectSendPackets(packets []Packet, priorities []SendPriority, packet Packet, priority SendPriority) (_ []Packet, _ []SendPriority, ok bool) {
+	if packet == nil {
+		logger.Debug("packet==nil %v", this.GetConnectionId())
+		return packets, priorities, false
+	}
+	this.sendLanes.onPop(priority)
+	// 这一批受发包限速的数据量(估算)
+	limitedBytes := 0
+	// 合并发送的占位数据包替换成最新的数据包
+	if resolvedPacket,hasPacket := this.sendLanes.coalescer.resolve(packet); hasPacket {
+		packets = append(packets, resolvedPacket)
+		priorities = append(priorities, priority)
+		limitedBytes += this.estimateLimitedBytes(resolvedPacket, priority)
+	}
+	// 还有其他数据包在chan里,就按优先级进行批量合并
+	packetCount := this.sendLanes.len()
+	for i := 0; i < packetCount; i++ {
+		// 受限速的数据已经攒够一次写入的数据量,剩下的数据包留给下一批,让不受限速的数据包有机会先发送
+		if limitedBytes > 0 && limitedBytes >= this.sendLimiter.maxWriteSize() {
+			break
+		}
+		// 这里不会阻塞
+		newPacket,newPriority,hasPacket := this.sendLanes.tryPop()
+		if !hasPacket {
+			break
+		}
+		if newPacket == nil {
+			logger.Debug("newPacket==nil %v", this.GetConnectionId())
+			return packets, priorities, false
 		}
+		packets = append(packets, newPacket)
+		priorities = append(priorities, newPriority)
+		limitedBytes += this.estimateLimitedBytes(newPacket, newPriority)
 	}
+	return packets, priorities, true
 }
 
-func (this *TcpConnectionNoRing) writePacket(packet Packet) bool {
-	// 这里编码的是包体,不包含包头
-	packetData := this.codec.Encode(this, packet)
-	// 包头数据
-	newPacketHeader := this.codec.CreatePacketHeader(this, packet, packetData)
-	packetHeaderData := make([]byte, this.codec.PacketHeaderSize())
-	newPacketHeader.WriteTo(packetHeaderData)
-	writeCount := 0
-	// 先发送包头数据
-	for writeCount < len(packetHeaderData) {
-		if this.config.WriteTimeout > 0 {
-			setTimeoutErr := this.conn.SetWriteDeadline(time.Now().Add(time.Duration(this.config.WriteTimeout)*time.Second))
-			// Q:什么情况会导致SetWriteDeadline返回err?
-			if setTimeoutErr != nil {
-				// ...
-				logger.Debug("%v setTimeoutErr:%v", this.GetConnectionId(), setTimeoutErr.Error())
+// 估算数据包受发包限速的字节数,不受限速时返回0
+func (this *TcpConnectionNoRing) estimateLimitedBytes(packet Packet, priority SendPriority) int {
+	if this.sendLimiter == nil || this.sendLimiter.maxWriteSize() == 0 {
+		return 0
+	}
+	if packet,_ = unwrapDeliveryPacket(packet); packet == nil || this.sendLimiter.isBypass(packet, priority) {
+		return 0
+	}
+	return int(this.codec.PacketHeaderSize()) + estimatePacketSize(packet)
+}
+
+// 批量发送数据包
+// 多个数据包的包头和包体通过net.Buffers合并成writev系统调用,每次最多写入NoRingWriteChunkSize字节
+// 设置了WriteTimeout时,每次写入都重新设置超时时间,大包在慢速网络上也不会超时
+// 受发包限速的数据每次最多写入maxWriteSize字节,写入之前等待令牌,不受限速的数据直接写入
+// priorities:每个数据包的优先级,用于判断是否受发包限速
+func (this *TcpConnectionNoRing) writePackets(packets []Packet, priorities []SendPriority) bool {
+	// 取出带发送结果回调的数据包,这一批数据包写入socket之后回调
+	var onDelivereds []DeliveryCallback
+	packetCount := 0
+	for i,packet := range packets {
+		packet,onDelivered := unwrapDeliveryPacket(packet)
+		if onDelivered != nil {
+			onDelivereds = append(onDelivereds, onDelivered)
+		}
+		if packet != nil {
+			packets[packetCount] = packet
+			priorities[packetCount] = priorities[i]
+			packetCount++
+		}
+	}
+	packets = packets[:packetCount]
+	var writeErr error
+	if len(onDelivereds) > 0 {
+		defer func() {
+			for _,onDelivered := range onDelivereds {
+				onDelivered(writeErr)
+			}
+		}()
+	}
+	if len(packets) == 0 {
+		return true
+	}
+	packetHeaderSize := int(this.codec.PacketHeaderSize())
+	// 所有包头共用一块内存
+	packetHeadersData := make([]byte, packetHeaderSize*len(packets))
+	buffers := make(net.Buffers, 0, len(packets)*2)
+	// buffers里的字节数
+	bufferedBytes := 0
+	// buffers里的数据是否受发包限速
+	limited := false
+	for i,packet := range packets {
+		packetLimited := this.sendLimiter != nil && !this.sendLimiter.isBypass(packet, priorities[i])
+		// 受限速和不受限速的数据分开写入
+		if len(buffers) > 0 && packetLimited != limited {
+			if writeErr = this.writeBuffers(buffers, limited); writeErr != nil {
 				return false
 			}
+			buffers = buffers[:0]
+			bufferedBytes = 0
 		}
-		n,err := this.conn.Write(packetHeaderData[writeCount:])
-		if err != nil {
-			logger.Error("%v send error:%v", this.GetConnectionId(), err.Error())
+		limited = packetLimited
+		// 这里编码的是包体,不包含包头
+		packetData := this.codec.Encode(this, packet)
+		// 包头数据
+		newPacketHeader := this.codec.CreatePacketHeader(this, packet, packetData)
+		packetHeaderData := packetHeadersData[i*packetHeaderSize:(i+1)*packetHeaderSize]
+		newPacketHeader.WriteTo(packetHeaderData)
+		buffers = append(buffers, packetHeaderData)
+		if len(packetData) > 0 {
+			buffers = append(buffers, packetData)
+		}
+		bufferedBytes += packetHeaderSize + len(packetData)
+		// 攒够一次写入的数据量就先发送,不把整批数据包都编码之后再发送
+		if bufferedBytes >= NoRingWriteChunkSize {
+			if writeErr = this.writeBuffers(buffers, limited); writeErr != nil {
+				return false
+			}
+			buffers = buffers[:0]
+			bufferedBytes = 0
+		}
+	}
+	if len(buffers) > 0 {
+		if writeErr = this.writeBuffers(buffers, limited); writeErr != nil {
 			return false
 		}
-		writeCount += n
 	}
+	return true
+}
 
-	writeCount = 0
-	// 再发送包体数据
-	for writeCount < len(packetData) {
+// 分段写入socket,每段最多NoRingWriteChunkSize字节
+// limited:是否受发包限速,受限速时每段最多maxWriteSize字节,每段写入之前等待令牌
+func (this *TcpConnectionNoRing) writeBuffers(buffers net.Buffers, limited bool) error {
+	chunkSize := NoRingWriteChunkSize
+	if limited {
+		if maxWriteSize := this.sendLimiter.maxWriteSize(); maxWriteSize > 0 && maxWriteSize < chunkSize {
+			chunkSize = maxWriteSize
+		}
+	}
+	for len(buffers) > 0 {
+		var chunk net.Buffers
+		chunk,buffers = splitBuffers(buffers, chunkSize)
+		if limited && !this.sendLimiter.wait(buffersLen(chunk), this.closeNotify) {
+			return ErrConnectionClosed
+		}
 		if this.config.WriteTimeout > 0 {
 			setTimeoutErr := this.conn.SetWriteDeadline(time.Now().Add(time.Duration(this.config.WriteTimeout)*time.Second))
 			// Q:什么情况会导致SetWriteDeadline返回err?
 			if setTimeoutErr != nil {
 				// ...
 				logger.Debug("%v setTimeoutErr:%v", this.GetConnectionId(), setTimeoutErr.Error())
-				return false
+				this.setCloseReason(CloseCodeWriteError, setTimeoutErr)
+				return setTimeoutErr
 			}
 		}
-		n,err := this.conn.Write(packetData[writeCount:])
+		// net.Buffers.WriteTo内部会处理部分写入的情况,直到全部写完或出错
+		_,err := chunk.WriteTo(this.conn)
 		if err != nil {
 			logger.Error("%v send error:%v", this.GetConnectionId(), err.Error())
-			return false
+			this.setCloseReason(CloseCodeWriteError, err)
+			return err
 		}
-		writeCount += n
 	}
-	return true
+	return nil
+}
+
+// net.Buffers里的字节数
+func buffersLen(buffers net.Buffers) int {
+	size := 0
+	for _,buffer := range buffers {
+		size += len(buffer)
+	}
+	return size
+}
+
+// 从buffers的头部切分出最多maxSize字节,不产生copy
+// 返回切分出的数据和剩余的数据
+func splitBuffers(buffers net.Buffers, maxSize int) (chunk, remain net.Buffers) {
+	size := 0
+	for i,buffer := range buffers {
+		if size+len(buffer) <= maxSize {
+			size += len(buffer)
+			continue
+		}
+		n := maxSize - size
+		chunk = make(net.Buffers, i, i+1)
+		copy(chunk, buffers[:i])
+		if n > 0 {
+			chunk = append(chunk, buffer[:n])
+		}
+		buffers[i] = buffer[n:]
+		return chunk, buffers[i:]
+	}
+	return buffers, nil
+}
+
+// 优雅关闭:不再接受新的发包,等待已有的数据发送完,关闭写端,等待对方关闭连接或者超时
+// 异步执行,关闭完成后会调用OnDisconnected
+func (this *TcpConnectionNoRing) CloseGracefully(timeout time.Duration) {
+	this.closeGracefully(this, this.conn, timeout)
 }
 
 // 关闭
 func (this *TcpConnectionNoRing) Close() {
 	this.closeOnce.Do(func() {
-		this.isConnected = false
+		// 没有记录关闭原因时,就是本地调用的Close
+		this.setCloseReason(CloseCodeLocal, nil)
+		this.setState(this, ConnectionStateClosed)
+		this.ctx.cancel()
+		close(this.closeNotify)
+		// 发包协程可能已经结束,发包缓存里剩余的数据包的回调返回ErrConnectionClosed
+		this.failQueuedDeliveries()
 		if this.conn != nil {
 			this.conn.Close()
 			logger.Debug("close %v", this.GetConnectionId())
 			//this.conn = nil
 		}
 		if this.handler != nil {
-			this.handler.OnDisconnected(this)
+			this.handler.OnDisconnected(this, this.GetCloseReason())
 		}
 		if this.onClose != nil {
 			this.onClose(this)
@@ -301,29 +541,62 @@ func (this *TcpConnectionNoRing) Close() {
 // 异步发送proto包
 // NOTE:调用Send(command,message)之后,不要再对message进行读写!
 func (this *TcpConnectionNoRing) Send(command PacketCommand, message proto.Message) bool {
-	if !this.isConnected {
+	if !this.canSend() {
 		return false
 	}
 	packet := NewProtoPacket(command, message)
-	// NOTE:当sendPacketCache满时,这里会阻塞
-	this.sendPacketCache <- packet
-	return true
+	// NOTE:当sendPacketCache满时,按照ConnectionConfig.SendOverflowPolicy处理,默认阻塞
+	return this.pushSendPacket(this, this.sendPacketCache, packet)
 }
 
 // 异步发送数据
 // NOTE:调用SendPacket(packet)之后,不要再对packet进行读写!
 func (this *TcpConnectionNoRing) SendPacket(packet Packet) bool {
-	if !this.isConnected {
+	if !this.canSend() {
 		return false
 	}
-	// NOTE:当sendPacketCache满时,这里会阻塞
-	this.sendPacketCache <- packet
-	return true
+	// NOTE:当sendPacketCache满时,按照ConnectionConfig.SendOverflowPolicy处理,默认阻塞
+	return this.pushSendPacket(this, this.sendPacketCache, packet)
+}
+
+// 按优先级异步发送数据,高优先级的数据包优先发送
+// NOTE:调用SendPacketWithPriority(packet,priority)之后,不要再对packet进行读写!
+func (this *TcpConnectionNoRing) SendPacketWithPriority(packet Packet, priority SendPriority) bool {
+	if !this.canSend() {
+		return false
+	}
+	// NOTE:当发包缓存满时,按照ConnectionConfig.SendOverflowPolicy处理,默认阻塞
+	return this.pushSendPacket(this, this.sendLanes.lane(priority), packet)
+}
+
+// 合并发送,同一个coalesceKey的数据包还在发包缓存里没有发送时,新的数据包会替换旧的数据包
+// NOTE:调用SendPacketCoalesce(packet,coalesceKey)之后,不要再对packet进行读写!
+func (this *TcpConnectionNoRing) SendPacketCoalesce(packet Packet, coalesceKey uint64) bool {
+	if !this.canSend() {
+		return false
+	}
+	return this.pushCoalescePacket(this, packet, coalesceKey)
+}
+
+// 异步发送数据,数据包写入socket成功或失败后回调onDelivered
+// onDelivered一般在发包协程中调用
+// NOTE:调用SendPacketWithCallback(packet,priority,onDelivered)之后,不要再对packet进行读写!
+func (this *TcpConnectionNoRing) SendPacketWithCallback(packet Packet, priority SendPriority, onDelivered DeliveryCallback) bool {
+	return this.pushDeliveryPacket(this, packet, priority, onDelivered)
+}
+
+// 等待发包缓存和发送缓存里的数据都写入socket
+// 如:发送踢人通知之后,等通知发出去再关闭连接
+func (this *TcpConnectionNoRing) Flush(ctx context.Context) error {
+	return this.flush(ctx)
 }
 
 // 超时发包,超时未发送则丢弃,适用于某些允许丢弃的数据包
 // 可以防止某些"不重要的"数据包造成chan阻塞,比如游戏项目常见的聊天广播
 func (this *TcpConnectionNoRing) TrySendPacket(packet Packet, timeout time.Duration) bool {
+	if !this.canSend() {
+		return false
+	}
 	if timeout == 0 {
 		// 非阻塞方式写chan
 		select {
@@ -342,7 +615,6 @@ func (this *TcpConnectionNoRing) TrySendPacket(packet Packet, timeout time.Durat
 			return false
 		}
 	}
-	return false
 }
 
 // LocalAddr returns the local network address.
@@ -362,5 +634,17 @@ func (this *TcpConnectionNoRing) RemoteAddr() net.Addr {
 }
 
 func (this *TcpConnectionNoRing) GetSendPacketChanLen() int {
-	return len(this.sendPacketCache)
+	return this.sendLanes.len()
+}
+
+// 等待恢复读取,恢复后重新计算收包超时
+func (this *TcpConnectionNoRing) waitReadResumeAndRefresh() bool {
+	if !this.IsReadPaused() {
+		return true
+	}
+	if !this.waitReadResume(this) {
+		return false
+	}
+	this.lastRecvPacketTick = GetCurrentTimeStamp()
+	return true
 }
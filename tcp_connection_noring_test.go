@@ -0,0 +1,20 @@
+package gnet
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestSplitBuffers(t *testing.T) {
+	buffers := net.Buffers{[]byte("abc"), []byte("defgh"), []byte("ij")}
+	var chunks []string
+	for len(buffers) > 0 {
+		var chunk net.Buffers
+		chunk, buffers = splitBuffers(buffers, 4)
+		chunks = append(chunks, string(bytes.Join(chunk, nil)))
+	}
+	if len(chunks) != 3 || chunks[0] != "abcd" || chunks[1] != "efgh" || chunks[2] != "ij" {
+		t.Fatalf("chunks:%v", chunks)
+	}
+}
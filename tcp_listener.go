@@ -29,11 +29,18 @@ type TcpListener struct {
 
 	acceptConnectionCreator AcceptConnectionCreator
 
+	// 所有accept连接共享的发包限速
+	sendBandwidthBucket *tokenBucket
+
 	// 外部传进来的WaitGroup
 	netMgrWg *sync.WaitGroup
 }
 
 func NewTcpListener(acceptConnectionConfig ConnectionConfig, acceptConnectionCodec Codec, acceptConnectionHandler ConnectionHandler, listenerHandler ListenerHandler) *TcpListener {
+	var sendBandwidthBucket *tokenBucket
+	if sendBandwidth := acceptConnectionConfig.SendBandwidth; sendBandwidth != nil {
+		sendBandwidthBucket = newBandwidthBucket(sendBandwidth.ListenerBytesPerSecond, sendBandwidth.ListenerBurstBytes)
+	}
 	return &TcpListener{
 		baseListener: baseListener{
 			listenerId: newListenerId(),
@@ -43,6 +50,7 @@ func NewTcpListener(acceptConnectionConfig ConnectionConfig, acceptConnectionCod
 		acceptConnectionCodec: acceptConnectionCodec,
 		acceptConnectionHandler: acceptConnectionHandler,
 		connectionMap: make(map[uint32]Connection),
+		sendBandwidthBucket: sendBandwidthBucket,
 	}
 }
 
@@ -111,7 +119,7 @@ func (this *TcpListener) Close() {
 		this.connectionMapLock.RUnlock()
 		// 关闭管理的连接
 		for _,conn := range connMap {
-			conn.Close()
+			closeWithReason(conn, CloseCodeShutdown, nil)
 		}
 		if this.onClose != nil {
 			this.onClose(this)
@@ -152,6 +160,11 @@ func (this *TcpListener) acceptLoop(ctx context.Context) {
 				}
 			}()
 			newTcpConn := this.acceptConnectionCreator(newConn, &this.acceptConnectionConfig, this.acceptConnectionCodec, this.acceptConnectionHandler)
+			if this.sendBandwidthBucket != nil {
+				if setter,ok := newTcpConn.(listenerSendBucketSetter); ok {
+					setter.setListenerSendBucket(this.sendBandwidthBucket)
+				}
+			}
 			if newTcpConn.GetHandler() != nil {
 				newTcpConn.GetHandler().OnConnected(newTcpConn,true)
 			}
@@ -160,7 +173,7 @@ func (this *TcpListener) acceptLoop(ctx context.Context) {
 			this.connectionMapLock.Unlock()
 			newTcpConn.Start(ctx, this.netMgrWg, func(connection Connection) {
 				if this.handler != nil {
-					this.handler.OnConnectionDisconnect(this, connection)
+					this.handler.OnConnectionDisconnect(this, connection, connection.GetCloseReason())
 				}
 			})
 			if this.handler != nil {
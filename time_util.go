@@ -6,3 +6,18 @@ import "time"
 func GetCurrentTimeStamp() uint32 {
 	return uint32(time.Now().UnixNano()/int64(time.Second))
 }
+
+// 等待一段时间,等待期间连接关闭时提前返回false
+func sleepOrClose(duration time.Duration, closeNotify <-chan struct{}) bool {
+	if duration <= 0 {
+		return true
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-closeNotify:
+		return false
+	}
+}